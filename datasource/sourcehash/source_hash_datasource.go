@@ -1,20 +1,22 @@
 package sourcehash
 
 import (
+	"context"
 	"encoding/hex"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/sha3"
 )
 
 func Resource() *schema.Resource {
 	return &schema.Resource{
-		Read: resourceRead,
+		ReadContext: resourceRead,
 
 		Schema: map[string]*schema.Schema{
 			"sources": &schema.Schema{
@@ -32,7 +34,7 @@ func Resource() *schema.Resource {
 	}
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 
 	schemaSet := d.Get("sources").(*schema.Set)
 	sources := []string{}
@@ -46,7 +48,7 @@ func resourceRead(d *schema.ResourceData, m interface{}) error {
 
 	hash, err := hashOfDirsAndFiles(sources)
 	if err != nil {
-		return errors.Wrap(err, "while calculating hash of source dirs")
+		return diag.FromErr(errors.Wrap(err, "while calculating hash of source dirs"))
 	}
 
 	d.Set("hash", hex.EncodeToString(hash))
@@ -1,42 +1,25 @@
 package textfile
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"time"
 
-	"github.com/alessio/shellescape"
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/numtide/terraform-provider-linuxbox/sshsession"
 )
 
 func Resource() *schema.Resource {
 	return &schema.Resource{
-		Read: resourceRead,
+		ReadContext: resourceRead,
 
-		Schema: map[string]*schema.Schema{
-			"ssh_key": {
-				Type:      schema.TypeString,
-				Required:  true,
-				Sensitive: true,
-			},
-
-			"ssh_user": {
-				Type:     schema.TypeString,
-				Required: false,
-				Default:  "root",
-				Optional: true,
-			},
-
-			"host_address": {
-				Type:     schema.TypeString,
-				Required: true,
-			},
-
-			"sudo": {
-				Type:     schema.TypeBool,
-				Optional: true,
-				Default:  false,
-			},
+		Timeouts: &schema.ResourceTimeout{
+			Read: schema.DefaultTimeout(5 * time.Minute),
+		},
 
+		Schema: sshsession.ConnectionSchema(map[string]*schema.Schema{
 			"path": {
 				Type:     schema.TypeString,
 				Required: true,
@@ -46,26 +29,25 @@ func Resource() *schema.Resource {
 				Type:     schema.TypeString,
 				Computed: true,
 			},
-		},
+		}),
 	}
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
-	path := d.Get("path").(string)
-
-	cmd := fmt.Sprintf("cat %s", shellescape.Quote(path))
-	if d.Get("sudo").(bool) {
-		cmd = fmt.Sprintf("sudo %s", cmd)
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
 	}
 
-	stdout, _, err := sshsession.Run(d, cmd)
+	path := d.Get("path").(string)
+
+	content := new(bytes.Buffer)
+	err = ex.Download(ctx, path, content)
 	if err != nil {
-		return fmt.Errorf("while getting content of %s: %w", path, err)
+		return sshsession.Diagnostics(fmt.Errorf("while getting content of %s: %w", path, err))
 	}
 
-	stdoutString := string(stdout)
-
-	d.Set("content", stdoutString)
+	d.Set("content", content.String())
 
 	d.SetId("-")
 
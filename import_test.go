@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession/sshtest"
+)
+
+func TestAccImport(t *testing.T) {
+	srv := sshtest.NewServer(t)
+
+	file := srv.Path("test.txt")
+	dir := srv.Path("test")
+
+	config := srv.ProviderConfig() + fmt.Sprintf(`
+resource "linuxbox_text_file" "test" {
+  path    = %q
+  content = "hello"
+  owner   = %[2]d
+  group   = %[3]d
+  mode    = "644"
+}
+
+resource "linuxbox_binary_file" "test" {
+  path           = "%[1]s.bin"
+  content_base64 = base64encode("hello")
+  owner          = %[2]d
+  group          = %[3]d
+  mode           = "644"
+}
+
+resource "linuxbox_directory" "test" {
+  path  = %[4]q
+  owner = %[2]d
+  group = %[3]d
+  mode  = "750"
+}
+`, file, os.Getuid(), os.Getgid(), dir)
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+			},
+			{
+				ResourceName:      "linuxbox_text_file.test",
+				Config:            config,
+				ImportState:       true,
+				ImportStateId:     ":" + file,
+				ImportStateVerify: true,
+			},
+			{
+				ResourceName:      "linuxbox_binary_file.test",
+				Config:            config,
+				ImportState:       true,
+				ImportStateId:     ":" + file + ".bin",
+				ImportStateVerify: true,
+			},
+			{
+				ResourceName:      "linuxbox_directory.test",
+				Config:            config,
+				ImportState:       true,
+				ImportStateId:     fmt.Sprintf("%s:%d:%s", srv.Host, srv.Port, dir),
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
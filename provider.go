@@ -1,11 +1,15 @@
 package main
 
 import (
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/numtide/terraform-provider-linuxbox/datasource/sourcehash"
 	datasource_textfile "github.com/numtide/terraform-provider-linuxbox/datasource/textfile"
 	"github.com/numtide/terraform-provider-linuxbox/resource/binaryfile"
 	"github.com/numtide/terraform-provider-linuxbox/resource/directory"
+	"github.com/numtide/terraform-provider-linuxbox/resource/directorysync"
 	"github.com/numtide/terraform-provider-linuxbox/resource/docker"
 	"github.com/numtide/terraform-provider-linuxbox/resource/docker/auth"
 	"github.com/numtide/terraform-provider-linuxbox/resource/docker/build"
@@ -13,6 +17,8 @@ import (
 	"github.com/numtide/terraform-provider-linuxbox/resource/docker/copyimage"
 	"github.com/numtide/terraform-provider-linuxbox/resource/docker/network"
 	"github.com/numtide/terraform-provider-linuxbox/resource/docker/run"
+	"github.com/numtide/terraform-provider-linuxbox/resource/fileblock"
+	"github.com/numtide/terraform-provider-linuxbox/resource/lineinfile"
 	"github.com/numtide/terraform-provider-linuxbox/resource/runsetup"
 	"github.com/numtide/terraform-provider-linuxbox/resource/ssh/authorizedkey"
 	"github.com/numtide/terraform-provider-linuxbox/resource/swap"
@@ -28,6 +34,11 @@ func Provider() *schema.Provider {
 				Default:  5,
 				Optional: true,
 			},
+			"known_hosts_file": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"connection": sshsession.ProviderSchema(),
 		},
 
 		DataSourcesMap: map[string]*schema.Resource{
@@ -37,6 +48,7 @@ func Provider() *schema.Provider {
 
 		ResourcesMap: map[string]*schema.Resource{
 			"linuxbox_directory":          directory.Resource(),
+			"linuxbox_directory_sync":     directorysync.Resource(),
 			"linuxbox_docker_auth":        auth.Resource(),
 			"linuxbox_docker_build":       build.Resource(),
 			"linuxbox_docker_container":   container.Resource(),
@@ -44,6 +56,8 @@ func Provider() *schema.Provider {
 			"linuxbox_docker_network":     network.Resource(),
 			"linuxbox_docker_run":         run.Resource(),
 			"linuxbox_docker":             docker.Resource(),
+			"linuxbox_file_block":         fileblock.Resource(),
+			"linuxbox_line_in_file":       lineinfile.Resource(),
 			"linuxbox_run_setup":          runsetup.Resource(),
 			"linuxbox_ssh_authorized_key": authorizedkey.Resource(),
 			"linuxbox_swap":               swap.Resource(),
@@ -51,9 +65,10 @@ func Provider() *schema.Provider {
 			"linuxbox_binary_file":        binaryfile.Resource(),
 		},
 
-		ConfigureFunc: func(d *schema.ResourceData) (interface{}, error) {
+		ConfigureContextFunc: func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
 			sshsession.SessionLimit = d.Get("ssh_session_limit").(int)
-			return nil, nil
+			sshsession.KnownHostsFile = d.Get("known_hosts_file").(string)
+			return sshsession.NewConnection(d), nil
 		},
 	}
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession/sshtest"
+)
+
+var testAccProviderFactories = map[string]func() (*schema.Provider, error){
+	"linuxbox": func() (*schema.Provider, error) {
+		return Provider(), nil
+	},
+}
+
+func TestProvider(t *testing.T) {
+	err := Provider().InternalValidate()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAccProviderConnection(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	path := srv.Path("test.txt")
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: srv.ProviderConfig() + fmt.Sprintf(`
+resource "linuxbox_text_file" "test" {
+  path    = %q
+  content = "hello"
+  owner   = %d
+  group   = %d
+}
+`, path, os.Getuid(), os.Getgid()),
+				Check: func(*terraform.State) error {
+					data, err := ioutil.ReadFile(path)
+					if err != nil {
+						return err
+					}
+
+					if string(data) != "hello" {
+						return fmt.Errorf("expected content %q of %s, got %q", "hello", path, data)
+					}
+
+					return nil
+				},
+			},
+		},
+	})
+}
@@ -1,45 +1,44 @@
 package binaryfile
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
-	"fmt"
-	"strconv"
+	"io"
+	"os"
+	"regexp"
 	"strings"
+	"time"
 
-	"github.com/alessio/shellescape"
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/numtide/terraform-provider-linuxbox/sshsession"
 	"github.com/pkg/errors"
 )
 
 func Resource() *schema.Resource {
-	return &schema.Resource{
-		Create: resourceUpdateAndCreate,
-		Read:   resourceRead,
-		Update: resourceUpdateAndCreate,
-		Delete: resourceDelete,
-
-		Schema: map[string]*schema.Schema{
-			"ssh_key": &schema.Schema{
-				Type:      schema.TypeString,
-				Required:  true,
-				Sensitive: true,
-			},
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
 
-			"ssh_user": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: false,
-				Default:  "root",
-				Optional: true,
-			},
+		Importer: sshsession.Importer(importFile),
 
-			"host_address": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
-			},
+		CustomizeDiff: customdiff.Sequence(sshsession.CustomizeHostDiff, customizeDiff),
 
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: sshsession.ConnectionSchema(sshsession.OwnerSchema(sshsession.BackupSchema(map[string]*schema.Schema{
 			"path": &schema.Schema{
 				Type:     schema.TypeString,
 				Required: true,
@@ -47,56 +46,118 @@ func Resource() *schema.Resource {
 			},
 
 			"content_base64": &schema.Schema{
-				Type:      schema.TypeString,
-				Sensitive: true,
-				Required:  true,
+				Type:         schema.TypeString,
+				Sensitive:    true,
+				Optional:     true,
+				ExactlyOneOf: []string{"content_base64", "source"},
+				DiffSuppressFunc: func(k, old, new string, d *schema.ResourceData) bool {
+					// without stored content, the hash tells if the content has changed
+					if old != "" || d.Get("store_content").(bool) {
+						return false
+					}
+					sum, err := contentSha256(new)
+					return err == nil && sum == d.Get("content_sha256").(string)
+				},
+			},
+
+			"source": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ExactlyOneOf: []string{"content_base64", "source"},
 			},
 
-			"owner": &schema.Schema{
-				Type:     schema.TypeInt,
+			"validate_command": &schema.Schema{
+				Type:     schema.TypeString,
 				Optional: true,
-				Default:  0,
+				ValidateDiagFunc: validation.ToDiagFunc(
+					validation.StringMatch(regexp.MustCompile(`%s`), "must contain %s, the path of the file to validate"),
+				),
 			},
 
-			"group": &schema.Schema{
-				Type:     schema.TypeInt,
+			"store_content": &schema.Schema{
+				Type:     schema.TypeBool,
 				Optional: true,
-				Default:  0,
+				Default:  true,
+			},
+
+			"content_sha256": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
 			},
 
 			"mode": &schema.Schema{
 				Type:     schema.TypeString,
 				Optional: true,
 				Default:  "755",
+				ValidateDiagFunc: validation.ToDiagFunc(
+					validation.StringMatch(regexp.MustCompile(`^[0-7]{3,4}$`), "must be an octal file mode, e.g. 644"),
+				),
 			},
-		},
-	}
+		}))),
+	})
 }
 
-func resourceUpdateAndCreate(d *schema.ResourceData, m interface{}) error {
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(resourceUpdateAndCreate(ctx, d, m))
+}
 
-	contentBase64 := []byte(strings.TrimRight(d.Get("content_base64").(string), " \t\n"))
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(resourceUpdateAndCreate(ctx, d, m))
+}
+
+func resourceUpdateAndCreate(ctx context.Context, d *schema.ResourceData, m interface{}) error {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return err
+	}
 
 	path := d.Get("path").(string)
 
-	owner := d.Get("owner").(int)
-	group := d.Get("group").(int)
+	owner, group := sshsession.Ownership(d)
 
 	mode := d.Get("mode").(string)
 
-	cmd := fmt.Sprintf(
-		"echo '%s' | base64 -d | cat > %s && chown %d:%d %s && chmod %s %s",
-		contentBase64,
-		shellescape.Quote(path),
-		owner,
-		group,
-		shellescape.Quote(path),
-		shellescape.Quote(mode),
-		shellescape.Quote(path),
-	)
-	stdout, stderr, err := sshsession.Run(d, cmd)
+	var content io.Reader
+
+	if source := d.Get("source").(string); source != "" {
+		// streamed, so large files are never held in memory
+		f, err := os.Open(source)
+		if err != nil {
+			return errors.Wrapf(err, "while opening source %s", source)
+		}
+		defer f.Close()
+
+		content = f
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimRight(d.Get("content_base64").(string), " \t\n"))
+		if err != nil {
+			return errors.Wrap(err, "while decoding content_base64")
+		}
+
+		content = bytes.NewReader(decoded)
+	}
+
+	err = sshsession.BackupFile(ctx, ex, d, path)
 	if err != nil {
-		return errors.Wrapf(err, "error while creating file %q:\nSTDOUT:\n%s\nSTDERR:\n%s\n", path, string(stdout), string(stderr))
+		return err
+	}
+
+	contentSum := sha256.New()
+
+	err = sshsession.WriteFile(ctx, ex, path, io.TeeReader(content, contentSum), sshsession.WriteFileOptions{
+		Owner:           owner,
+		Group:           group,
+		Mode:            mode,
+		ValidateCommand: d.Get("validate_command").(string),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "while creating file %q", path)
+	}
+
+	d.Set("content_sha256", hex.EncodeToString(contentSum.Sum(nil)))
+
+	if !d.Get("store_content").(bool) {
+		d.Set("content_base64", "")
 	}
 
 	sh := sha256.New()
@@ -109,71 +170,130 @@ func resourceUpdateAndCreate(d *schema.ResourceData, m interface{}) error {
 	return nil
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	path := d.Get("path").(string)
 
-	{
-		cmd := fmt.Sprintf("stat -c '%%u %%g %%a' %s", shellescape.Quote(path))
-
-		stdout, _, err := sshsession.Run(d, cmd)
-		if err != nil {
-			d.SetId("")
-			return nil
-		}
+	info, err := sshsession.Stat(ctx, d, m, path)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
-		stdoutString := string(stdout)
+	if info == nil {
+		// the path does not exist anymore
+		d.SetId("")
+		return nil
+	}
 
-		stdoutString = strings.TrimSuffix(stdoutString, "\n")
+	sshsession.SetOwnership(d, info)
+	d.Set("mode", info.Mode)
 
-		parts := strings.Split(stdoutString, " ")
-		if len(parts) != 3 {
-			return errors.Errorf("malformed output of %q: %q", cmd, stdoutString)
-		}
+	// the content is only downloaded when it has changed
+	remoteSum, err := sshsession.Sha256(ctx, d, m, path)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
-		owner, err := strconv.Atoi(parts[0])
-		if err != nil {
-			return errors.Wrapf(err, "while parsing owner id %q", parts[0])
-		}
+	if remoteSum == d.Get("content_sha256").(string) {
+		return nil
+	}
 
-		d.Set("owner", owner)
+	d.Set("content_sha256", remoteSum)
 
-		group, err := strconv.Atoi(parts[1])
-		if err != nil {
-			return errors.Wrapf(err, "while parsing group id %q", parts[1])
-		}
+	if !d.Get("store_content").(bool) || d.Get("source").(string) != "" {
+		// the changed hash is enough to plan an update
+		return nil
+	}
 
-		d.Set("group", group)
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
-		d.Set("mode", parts[2])
+	content := new(bytes.Buffer)
+	err = ex.Download(ctx, path, content)
+	if err != nil {
+		return sshsession.Diagnostics(errors.Wrapf(err, "while getting content of %s", path))
 	}
 
-	{
+	d.Set("content_base64", base64.StdEncoding.EncodeToString(content.Bytes()))
+
+	return nil
+}
 
-		cmd := fmt.Sprintf("cat %s | base64 -w 0", shellescape.Quote(path))
-		stdout, _, err := sshsession.Run(d, cmd)
+// customizeDiff plans the hash of changed content. The hash of source is
+// taken on every plan, so changes of the local file are detected.
+func customizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if !d.NewValueKnown("source") || !d.NewValueKnown("content_base64") {
+		return d.SetNewComputed("content_sha256")
+	}
+
+	if source := d.Get("source").(string); source != "" {
+		sum, err := fileSha256(source)
 		if err != nil {
-			return errors.Wrapf(err, "while getting content of %s", path)
+			return err
 		}
 
-		stdoutString := strings.TrimRight(string(stdout), " \t\n")
-
-		d.Set("content_base64", stdoutString)
+		return d.SetNew("content_sha256", sum)
+	}
 
+	if !d.HasChange("content_base64") {
+		return nil
 	}
 
-	return nil
+	sum, err := contentSha256(d.Get("content_base64").(string))
+	if err != nil {
+		// reported by Create and Update
+		return d.SetNewComputed("content_sha256")
+	}
 
+	return d.SetNew("content_sha256", sum)
 }
 
-func resourceDelete(d *schema.ResourceData, m interface{}) error {
-	path := d.Get("path").(string)
+// fileSha256 returns the hash of the local file at path.
+func fileSha256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "while opening source %s", path)
+	}
+	defer f.Close()
 
-	cmd := fmt.Sprintf("rm -f %s", shellescape.Quote(path))
+	sh := sha256.New()
+
+	_, err = io.Copy(sh, f)
+	if err != nil {
+		return "", errors.Wrapf(err, "while reading source %s", path)
+	}
+
+	return hex.EncodeToString(sh.Sum(nil)), nil
+}
 
-	stdout, stderr, err := sshsession.Run(d, cmd)
+// contentSha256 returns the hash of the content encoded in contentBase64.
+func contentSha256(contentBase64 string) (string, error) {
+	content, err := base64.StdEncoding.DecodeString(strings.TrimRight(contentBase64, " \t\n"))
 	if err != nil {
-		return errors.Wrapf(err, "error while deletin file %s:\nSTDOUT:\n%s\nSTDERR:\n%s\n", path, string(stdout), string(stderr))
+		return "", err
 	}
 
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func importFile(ctx context.Context, d *schema.ResourceData, m interface{}, path string) error {
+	sum := sha256.Sum256([]byte(path))
+	d.SetId(hex.EncodeToString(sum[:]))
+	d.Set("path", path)
+	d.Set("store_content", true)
+	sshsession.ImportBackup(d)
 	return nil
 }
+
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
+
+	path := d.Get("path").(string)
+
+	return sshsession.Diagnostics(sshsession.DeleteFile(ctx, ex, d, path))
+}
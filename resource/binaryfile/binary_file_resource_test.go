@@ -0,0 +1,139 @@
+package binaryfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession/sshtest"
+)
+
+func TestAccBinaryFile(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	path := srv.Path("test.bin")
+
+	content := []byte{0, 1, 2, 0xff, '\n', 0xfe, 0}
+	changed := []byte{0xde, 0xad, 0xbe, 0xef}
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: sshtest.ProviderFactories(map[string]*schema.Resource{
+			"linuxbox_binary_file": Resource(),
+		}),
+		CheckDestroy: func(*terraform.State) error {
+			_, err := os.Stat(path)
+			if !os.IsNotExist(err) {
+				return fmt.Errorf("expected %s to be deleted, got %v", path, err)
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: testConfig(srv, path, content),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckFile(path, content),
+					resource.TestCheckResourceAttr("linuxbox_binary_file.test", "content_sha256", fmt.Sprintf("%x", sha256.Sum256(content))),
+				),
+			},
+			{
+				Config: testConfig(srv, path, changed),
+				Check:  testCheckFile(path, changed),
+			},
+		},
+	})
+}
+
+func TestAccBinaryFileSource(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	path := srv.Path("test.bin")
+	source := filepath.Join(t.TempDir(), "source.bin")
+
+	content := []byte{0, 1, 2, 0xff, '\n', 0xfe, 0}
+	changed := []byte{0xde, 0xad, 0xbe, 0xef}
+
+	err := ioutil.WriteFile(source, content, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := fmt.Sprintf(`
+resource "linuxbox_binary_file" "test" {
+  %s
+  path   = %q
+  source = %q
+  owner  = %d
+  group  = %d
+  mode   = "640"
+}
+`, srv.Config(), path, source, os.Getuid(), os.Getgid())
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: sshtest.ProviderFactories(map[string]*schema.Resource{
+			"linuxbox_binary_file": Resource(),
+		}),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					testCheckFile(path, content),
+					resource.TestCheckResourceAttr("linuxbox_binary_file.test", "content_sha256", fmt.Sprintf("%x", sha256.Sum256(content))),
+				),
+			},
+			{
+				// the local file changes, the plan picks up its new hash
+				PreConfig: func() {
+					err := ioutil.WriteFile(source, changed, 0600)
+					if err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config,
+				Check:  testCheckFile(path, changed),
+			},
+		},
+	})
+}
+
+func testConfig(srv *sshtest.Server, path string, content []byte) string {
+	return fmt.Sprintf(`
+resource "linuxbox_binary_file" "test" {
+  %s
+  path           = %q
+  content_base64 = %q
+  owner          = %d
+  group          = %d
+  mode           = "640"
+}
+`, srv.Config(), path, base64.StdEncoding.EncodeToString(content), os.Getuid(), os.Getgid())
+}
+
+func testCheckFile(path string, content []byte) resource.TestCheckFunc {
+	return func(*terraform.State) error {
+		st, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if st.Mode().Perm() != 0640 {
+			return fmt.Errorf("expected mode 640 of %s, got %o", path, st.Mode().Perm())
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(data, content) {
+			return fmt.Errorf("expected content %x of %s, got %x", content, path, data)
+		}
+
+		return nil
+	}
+}
@@ -1,94 +1,90 @@
 package directory
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"strconv"
-	"strings"
+	"regexp"
+	"time"
 
 	"github.com/alessio/shellescape"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/numtide/terraform-provider-linuxbox/sshsession"
 	"github.com/pkg/errors"
 )
 
 func Resource() *schema.Resource {
-	return &schema.Resource{
-		Create: resourceUpdateAndCreate,
-		Read:   resourceRead,
-		Update: resourceUpdateAndCreate,
-		Delete: resourceDelete,
-
-		Schema: map[string]*schema.Schema{
-			"ssh_key": &schema.Schema{
-				Type:      schema.TypeString,
-				Required:  true,
-				Sensitive: true,
-			},
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
 
-			"ssh_user": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: false,
-				Default:  "root",
-				Optional: true,
-			},
+		Importer: sshsession.Importer(importDirectory),
 
-			"host_address": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
-			},
+		CustomizeDiff: sshsession.CustomizeHostDiff,
 
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: sshsession.ConnectionSchema(sshsession.OwnerSchema(map[string]*schema.Schema{
 			"path": &schema.Schema{
 				Type:     schema.TypeString,
 				Required: true,
 				ForceNew: true,
 			},
 
-			"owner": &schema.Schema{
-				Type:     schema.TypeInt,
-				Optional: true,
-				Default:  0,
-			},
-
-			"group": &schema.Schema{
-				Type:     schema.TypeInt,
-				Optional: true,
-				Default:  0,
-			},
-
 			"mode": &schema.Schema{
 				Type:     schema.TypeString,
 				Optional: true,
 				Default:  "755",
+				ValidateDiagFunc: validation.ToDiagFunc(
+					validation.StringMatch(regexp.MustCompile(`^[0-7]{3,4}$`), "must be an octal file mode, e.g. 644"),
+				),
 			},
-		},
-	}
+		})),
+	})
 }
 
-func resourceUpdateAndCreate(d *schema.ResourceData, m interface{}) error {
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(resourceUpdateAndCreate(ctx, d, m))
+}
+
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(resourceUpdateAndCreate(ctx, d, m))
+}
+
+func resourceUpdateAndCreate(ctx context.Context, d *schema.ResourceData, m interface{}) error {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return err
+	}
 
 	path := d.Get("path").(string)
 
-	owner := d.Get("owner").(int)
-	group := d.Get("group").(int)
+	owner, group := sshsession.Ownership(d)
 
 	mode := d.Get("mode").(string)
 
-	cmd := fmt.Sprintf("mkdir -p %s && chmod %s %s && chown %d:%d %s",
+	cmd := fmt.Sprintf("mkdir -p %s && chmod %s %s && chown %s %s",
 		shellescape.Quote(path),
 		shellescape.Quote(mode),
 		shellescape.Quote(path),
-		owner,
-		group,
+		shellescape.Quote(owner+":"+group),
 		shellescape.Quote(path),
 	)
 
-	stdout, stderr, err := sshsession.Run(d, cmd)
+	_, _, err = ex.Run(ctx, cmd)
 	if err != nil {
-		return errors.Wrapf(err, "error while creating dir %q:\nSTDOUT:\n%s\nSTDERR:\n%s\n", path, string(stdout), string(stderr))
+		return errors.Wrapf(err, "while creating dir %q", path)
 	}
 
 	sh := sha256.New()
@@ -101,56 +97,46 @@ func resourceUpdateAndCreate(d *schema.ResourceData, m interface{}) error {
 	return nil
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	path := d.Get("path").(string)
 
-	{
-		cmd := fmt.Sprintf("stat -c '%%u %%g %%a' %s", shellescape.Quote(path))
-
-		stdout, _, err := sshsession.Run(d, cmd)
-		if err != nil {
-			d.SetId("")
-			return nil
-		}
-
-		stdoutString := string(stdout)
-
-		stdoutString = strings.TrimSuffix(stdoutString, "\n")
-
-		parts := strings.Split(stdoutString, " ")
-		if len(parts) != 3 {
-			return errors.Errorf("malformed output of %q: %q", cmd, stdoutString)
-		}
-
-		owner, err := strconv.Atoi(parts[0])
-		if err != nil {
-			return errors.Wrapf(err, "while parsing owner id %q", parts[0])
-		}
-
-		d.Set("owner", owner)
-
-		group, err := strconv.Atoi(parts[1])
-		if err != nil {
-			return errors.Wrapf(err, "while parsing group id %q", parts[1])
-		}
-
-		d.Set("group", group)
+	info, err := sshsession.Stat(ctx, d, m, path)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
-		d.Set("mode", parts[2])
+	if info == nil {
+		// the path does not exist anymore
+		d.SetId("")
+		return nil
 	}
 
+	sshsession.SetOwnership(d, info)
+	d.Set("mode", info.Mode)
+
 	return nil
+}
 
+func importDirectory(ctx context.Context, d *schema.ResourceData, m interface{}, path string) error {
+	sum := sha256.Sum256([]byte(path))
+	d.SetId(hex.EncodeToString(sum[:]))
+	d.Set("path", path)
+	return nil
 }
 
-func resourceDelete(d *schema.ResourceData, m interface{}) error {
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
+
 	path := d.Get("path").(string)
 
 	cmd := fmt.Sprintf("rm -rf %s", shellescape.Quote(path))
 
-	stdout, stderr, err := sshsession.Run(d, cmd)
+	_, _, err = ex.Run(ctx, cmd)
 	if err != nil {
-		return errors.Wrapf(err, "error while deleting dir %q:\nSTDOUT:\n%s\nSTDERR:\n%s\n", path, string(stdout), string(stderr))
+		return sshsession.Diagnostics(errors.Wrapf(err, "while deleting dir %q", path))
 	}
 
 	return nil
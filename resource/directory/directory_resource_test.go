@@ -0,0 +1,122 @@
+package directory
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession/sshtest"
+)
+
+func TestAccDirectory(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	path := srv.Path("test")
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: sshtest.ProviderFactories(map[string]*schema.Resource{
+			"linuxbox_directory": Resource(),
+		}),
+		CheckDestroy: func(*terraform.State) error {
+			_, err := os.Stat(path)
+			if !os.IsNotExist(err) {
+				return fmt.Errorf("expected %s to be deleted, got %v", path, err)
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: testConfig(srv, path, "700"),
+				Check:  testCheckDirectory(path, 0700),
+			},
+			{
+				Config: testConfig(srv, path, "750"),
+				Check:  testCheckDirectory(path, 0750),
+			},
+			{
+				// the directory is removed behind the back of terraform
+				PreConfig: func() {
+					err := os.Remove(path)
+					if err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: testConfig(srv, path, "750"),
+				Check:  testCheckDirectory(path, 0750),
+			},
+		},
+	})
+}
+
+func TestAccDirectoryOwnerName(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	path := srv.Path("test")
+
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := user.LookupGroupId(u.Gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: sshtest.ProviderFactories(map[string]*schema.Resource{
+			"linuxbox_directory": Resource(),
+		}),
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+resource "linuxbox_directory" "test" {
+  %s
+  path       = %q
+  owner_name = %q
+  group_name = %q
+  mode       = "700"
+}
+`, srv.Config(), path, u.Username, g.Name),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckDirectory(path, 0700),
+					resource.TestCheckResourceAttr("linuxbox_directory.test", "owner_name", u.Username),
+					resource.TestCheckResourceAttr("linuxbox_directory.test", "group_name", g.Name),
+				),
+			},
+		},
+	})
+}
+
+func testConfig(srv *sshtest.Server, path, mode string) string {
+	return fmt.Sprintf(`
+resource "linuxbox_directory" "test" {
+  %s
+  path  = %q
+  owner = %d
+  group = %d
+  mode  = %q
+}
+`, srv.Config(), path, os.Getuid(), os.Getgid(), mode)
+}
+
+func testCheckDirectory(path string, mode os.FileMode) resource.TestCheckFunc {
+	return func(*terraform.State) error {
+		st, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if !st.IsDir() {
+			return fmt.Errorf("expected %s to be a directory", path)
+		}
+
+		if st.Mode().Perm() != mode {
+			return fmt.Errorf("expected mode %o of %s, got %o", mode, path, st.Mode().Perm())
+		}
+
+		return nil
+	}
+}
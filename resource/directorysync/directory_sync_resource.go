@@ -0,0 +1,576 @@
+package directorysync
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession"
+	"github.com/pkg/errors"
+)
+
+func Resource() *schema.Resource {
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
+
+		CustomizeDiff: customdiff.Sequence(sshsession.CustomizeHostDiff, customizeDiff),
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: sshsession.ConnectionSchema(map[string]*schema.Schema{
+			"source": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			"destination": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			"exclude": &schema.Schema{
+				Type: schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional: true,
+			},
+
+			"delete_extraneous": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			"source_hash": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"files": &schema.Schema{
+				Type: schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Computed: true,
+			},
+		}),
+	})
+}
+
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(resourceUpdateAndCreate(ctx, d, m))
+}
+
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(resourceUpdateAndCreate(ctx, d, m))
+}
+
+func resourceUpdateAndCreate(ctx context.Context, d *schema.ResourceData, m interface{}) error {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return err
+	}
+
+	source := d.Get("source").(string)
+	destination := d.Get("destination").(string)
+	exclude := excludePatterns(d.Get("exclude"))
+
+	files, err := localFiles(source, exclude)
+	if err != nil {
+		return err
+	}
+
+	// the tree is streamed as tar archive through the stdin of a single
+	// command, whatever the number of files
+	archive, w := io.Pipe()
+	go func() {
+		w.CloseWithError(writeArchive(w, source, files))
+	}()
+
+	cmd := fmt.Sprintf(
+		"mkdir -p %s && tar -x --no-same-owner -C %s -f -",
+		shellescape.Quote(destination),
+		shellescape.Quote(destination),
+	)
+
+	_, _, err = ex.RunWithStdin(ctx, cmd, archive)
+	archive.Close()
+	if err != nil {
+		return errors.Wrapf(err, "while copying %s to %s", source, destination)
+	}
+
+	if d.Get("delete_extraneous").(bool) {
+		err = deleteExtraneous(ctx, ex, destination, files, exclude)
+		if err != nil {
+			return err
+		}
+	}
+
+	hash, err := localHash(source, files)
+	if err != nil {
+		return err
+	}
+
+	d.Set("source_hash", hash)
+
+	d.Set("files", syncedPaths(files))
+
+	sum := sha256.Sum256([]byte(destination))
+	d.SetId(hex.EncodeToString(sum[:]))
+
+	return nil
+}
+
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
+
+	destination := d.Get("destination").(string)
+	exclude := excludePatterns(d.Get("exclude"))
+
+	info, err := sshsession.Stat(ctx, d, m, destination)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
+
+	if info == nil {
+		d.SetId("")
+		return nil
+	}
+
+	remote, err := remoteHashes(ctx, ex, destination)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
+
+	if !d.Get("delete_extraneous").(bool) {
+		// files only present on the host are no drift, unless they
+		// would have been deleted
+		known := map[string]string{}
+		for _, name := range syncedFiles(d) {
+			if sum, found := remote[name]; found {
+				known[name] = sum
+			} else {
+				known[name] = "missing"
+			}
+		}
+		remote = known
+	}
+
+	for name := range remote {
+		if excluded(name, exclude) {
+			delete(remote, name)
+		}
+	}
+
+	d.Set("source_hash", treeHash(remote))
+
+	return nil
+}
+
+// customizeDiff plans the hash of the local directory, so that changes of
+// the local files are detected.
+func customizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if !d.NewValueKnown("source") || !d.NewValueKnown("exclude") {
+		err := d.SetNewComputed("files")
+		if err != nil {
+			return err
+		}
+		return d.SetNewComputed("source_hash")
+	}
+
+	source := d.Get("source").(string)
+	exclude := excludePatterns(d.Get("exclude"))
+
+	files, err := localFiles(source, exclude)
+	if err != nil {
+		return err
+	}
+
+	hash, err := localHash(source, files)
+	if err != nil {
+		return err
+	}
+
+	err = d.SetNew("files", syncedPaths(files))
+	if err != nil {
+		return err
+	}
+
+	return d.SetNew("source_hash", hash)
+}
+
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
+
+	destination := d.Get("destination").(string)
+
+	info, err := sshsession.Stat(ctx, d, m, destination)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
+
+	if info == nil {
+		return nil
+	}
+
+	err = runChunked(ctx, ex, destination, "rm -f -- %s", syncedFiles(d))
+	if err != nil {
+		return sshsession.Diagnostics(errors.Wrapf(err, "while deleting files in %s", destination))
+	}
+
+	// directories are only removed once empty, deepest first, so that the
+	// files of others are kept
+	dirs := []string{}
+	for _, name := range d.Get("files").([]interface{}) {
+		if strings.HasSuffix(name.(string), "/") {
+			dirs = append(dirs, name.(string))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+
+	err = runChunked(ctx, ex, destination, "rmdir -- %s 2>/dev/null; true", dirs)
+	if err != nil {
+		return sshsession.Diagnostics(errors.Wrapf(err, "while deleting dir %q", destination))
+	}
+
+	cmd := fmt.Sprintf("rmdir %s 2>/dev/null; true", shellescape.Quote(destination))
+
+	_, _, err = ex.Run(ctx, cmd)
+	if err != nil {
+		return sshsession.Diagnostics(errors.Wrapf(err, "while deleting dir %q", destination))
+	}
+
+	return nil
+}
+
+// syncedPaths returns the relative paths of files, directories with a
+// trailing slash. They are the only paths removed on destroy.
+func syncedPaths(files []localFile) []string {
+	paths := []string{}
+	for _, f := range files {
+		if f.info.IsDir() {
+			paths = append(paths, f.name+"/")
+		} else {
+			paths = append(paths, f.name)
+		}
+	}
+	return paths
+}
+
+// syncedFiles returns the regular files written by the last apply.
+func syncedFiles(d *schema.ResourceData) []string {
+	files := []string{}
+	for _, name := range d.Get("files").([]interface{}) {
+		if !strings.HasSuffix(name.(string), "/") {
+			files = append(files, name.(string))
+		}
+	}
+	return files
+}
+
+func excludePatterns(v interface{}) []string {
+	exclude := []string{}
+	for _, e := range v.([]interface{}) {
+		exclude = append(exclude, e.(string))
+	}
+	return exclude
+}
+
+// excluded reports if the relative path name, or one of the directories
+// containing it, matches one of the patterns. Patterns without slash match
+// the base name at any depth, like in .gitignore.
+func excluded(name string, patterns []string) bool {
+	for p := name; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		for _, pattern := range patterns {
+			target := p
+			if !strings.Contains(pattern, "/") {
+				target = path.Base(p)
+			}
+
+			if ok, _ := path.Match(strings.TrimSuffix(pattern, "/"), target); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type localFile struct {
+	// name is the slash separated path relative to the source directory.
+	name string
+	info os.FileInfo
+}
+
+// localFiles lists the directories and regular files below source, which
+// are not excluded. Other files, e.g. symlinks, are skipped.
+func localFiles(source string, exclude []string) ([]localFile, error) {
+	files := []localFile{}
+
+	err := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == source {
+			if !info.IsDir() {
+				return errors.Errorf("source %s is not a directory", source)
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if excluded(name, exclude) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() || info.Mode().IsRegular() {
+			files = append(files, localFile{name: name, info: info})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "while reading source %s", source)
+	}
+
+	return files, nil
+}
+
+func writeArchive(w io.Writer, source string, files []localFile) error {
+	tw := tar.NewWriter(w)
+
+	for _, f := range files {
+		hdr, err := tar.FileInfoHeader(f.info, "")
+		if err != nil {
+			return errors.Wrapf(err, "while creating tar header of %s", f.name)
+		}
+
+		hdr.Name = f.name
+		// owned by the user running the command on the host
+		hdr.Uid, hdr.Gid = 0, 0
+		hdr.Uname, hdr.Gname = "", ""
+
+		err = tw.WriteHeader(hdr)
+		if err != nil {
+			return errors.Wrapf(err, "while writing tar header of %s", f.name)
+		}
+
+		if f.info.IsDir() {
+			continue
+		}
+
+		err = copyFile(tw, filepath.Join(source, filepath.FromSlash(f.name)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "while opening %s", path)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	if err != nil {
+		return errors.Wrapf(err, "while reading %s", path)
+	}
+
+	return nil
+}
+
+// localHash hashes the content of the regular files, like remoteHashes and
+// treeHash do on the host.
+func localHash(source string, files []localFile) (string, error) {
+	sums := map[string]string{}
+
+	for _, f := range files {
+		if f.info.IsDir() {
+			continue
+		}
+
+		sh := sha256.New()
+		err := copyFile(sh, filepath.Join(source, filepath.FromSlash(f.name)))
+		if err != nil {
+			return "", err
+		}
+
+		sums[f.name] = hex.EncodeToString(sh.Sum(nil))
+	}
+
+	return treeHash(sums), nil
+}
+
+// treeHash combines the hashes of the files in sums, keyed by their relative
+// path, into a single hash.
+//
+// It is deliberately not the hash of the sourcehash data source, which is
+// the SHA3 of the concatenated content of the files: the host only has
+// sha256sum to hash its side, and the paths must be part of the hash so that
+// renaming a file is detected. Switching the data source over would change
+// the hash of every existing configuration using it.
+func treeHash(sums map[string]string) string {
+	names := []string{}
+	for name := range sums {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	sh := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(sh, "%s %q\n", sums[name], name)
+	}
+
+	return hex.EncodeToString(sh.Sum(nil))
+}
+
+// remoteHashes returns the hashes of the regular files below destination,
+// keyed by their relative path.
+func remoteHashes(ctx context.Context, ex sshsession.Executor, destination string) (map[string]string, error) {
+	// hashing stdin, as sha256sum escapes unusual file names in its output
+	hash := `for f; do printf '%s %s\0' "$(sha256sum < "$f" | cut -d ' ' -f 1)" "${f#./}"; done`
+	cmd := fmt.Sprintf(
+		"cd %s && find . -type f -exec sh -c %s sh {} +",
+		shellescape.Quote(destination),
+		shellescape.Quote(hash),
+	)
+
+	stdout, _, err := ex.Run(ctx, cmd)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while hashing files in %s", destination)
+	}
+
+	sums := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	scanner.Buffer(nil, 1024*1024)
+	scanner.Split(splitNul)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("malformed hash output %q", scanner.Text())
+		}
+		sums[parts[1]] = parts[0]
+	}
+
+	return sums, scanner.Err()
+}
+
+func splitNul(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+// deleteExtraneous removes the files and directories below destination,
+// which are neither in files nor excluded.
+func deleteExtraneous(ctx context.Context, ex sshsession.Executor, destination string, files []localFile, exclude []string) error {
+	cmd := fmt.Sprintf(`cd %s && find . -mindepth 1 -print0`, shellescape.Quote(destination))
+
+	stdout, _, err := ex.Run(ctx, cmd)
+	if err != nil {
+		return errors.Wrapf(err, "while listing files in %s", destination)
+	}
+
+	wanted := map[string]bool{}
+	for _, f := range files {
+		wanted[f.name] = true
+	}
+
+	extraneous := []string{}
+	for _, p := range bytes.Split(stdout, []byte{0}) {
+		name := strings.TrimPrefix(string(p), "./")
+		if name == "" || wanted[name] || excluded(name, exclude) {
+			continue
+		}
+
+		// skip the content of directories which are removed anyway
+		if len(extraneous) > 0 && strings.HasPrefix(name, extraneous[len(extraneous)-1]+"/") {
+			continue
+		}
+
+		extraneous = append(extraneous, name)
+	}
+
+	err = runChunked(ctx, ex, destination, "rm -rf -- %s", extraneous)
+	if err != nil {
+		return errors.Wrapf(err, "while deleting extraneous files in %s", destination)
+	}
+
+	return nil
+}
+
+// runChunked runs the command cmd in destination, with %s replaced by up to
+// 100 of the relative paths names at a time, keeping the command lines short.
+func runChunked(ctx context.Context, ex sshsession.Executor, destination, cmd string, names []string) error {
+	for len(names) > 0 {
+		n := len(names)
+		if n > 100 {
+			n = 100
+		}
+
+		quoted := []string{}
+		for _, name := range names[:n] {
+			quoted = append(quoted, shellescape.Quote(name))
+		}
+
+		_, _, err := ex.Run(ctx, fmt.Sprintf("cd %s && "+cmd, shellescape.Quote(destination), strings.Join(quoted, " ")))
+		if err != nil {
+			return err
+		}
+
+		names = names[n:]
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package directorysync
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession/sshtest"
+)
+
+func TestAccDirectorySync(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	path := srv.Path("test")
+	source := t.TempDir()
+
+	writeFiles(t, source, map[string]string{
+		"a.txt":       "a",
+		"sub/b.txt":   "b",
+		"sub/c.log":   "c",
+		"cache/d.txt": "d",
+	})
+
+	config := fmt.Sprintf(`
+resource "linuxbox_directory_sync" "test" {
+  %s
+  source            = %q
+  destination       = %q
+  exclude           = ["*.log", "cache"]
+  delete_extraneous = true
+}
+`, srv.Config(), source, path)
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: sshtest.ProviderFactories(map[string]*schema.Resource{
+			"linuxbox_directory_sync": Resource(),
+		}),
+		// the excluded file was not synced, so it is kept
+		CheckDestroy: testCheckFiles(path, map[string]string{
+			"f.log": "f",
+		}),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: testCheckFiles(path, map[string]string{
+					"a.txt":     "a",
+					"sub/b.txt": "b",
+				}),
+			},
+			{
+				// a local change and a file added on the host
+				PreConfig: func() {
+					writeFiles(t, source, map[string]string{"a.txt": "changed"})
+					writeFiles(t, path, map[string]string{"extra/e.txt": "e", "f.log": "f"})
+				},
+				Config: config,
+				Check: testCheckFiles(path, map[string]string{
+					"a.txt":     "changed",
+					"sub/b.txt": "b",
+					"f.log":     "f",
+				}),
+			},
+		},
+	})
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testCheckFiles(dir string, files map[string]string) resource.TestCheckFunc {
+	return func(*terraform.State) error {
+		found := map[string]string{}
+
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			found[filepath.ToSlash(rel)] = string(data)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(found) != len(files) {
+			return fmt.Errorf("expected files %v in %s, got %v", files, dir, found)
+		}
+
+		for name, content := range files {
+			if found[name] != content {
+				return fmt.Errorf("expected content %q of %s, got %q", content, name, found[name])
+			}
+		}
+
+		return nil
+	}
+}
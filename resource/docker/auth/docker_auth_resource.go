@@ -1,44 +1,40 @@
 package auth
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/alessio/shellescape"
 	"github.com/numtide/terraform-provider-linuxbox/sshsession"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/pkg/errors"
 )
 
 func Resource() *schema.Resource {
-	return &schema.Resource{
-		Create: resourceCreate,
-		Read:   resourceRead,
-		Update: resourceUpdate,
-		Delete: resourceDelete,
-
-		Schema: map[string]*schema.Schema{
-			"ssh_key": &schema.Schema{
-				Type:      schema.TypeString,
-				Required:  true,
-				Sensitive: true,
-			},
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
 
-			"ssh_user": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: false,
-				Default:  "root",
-				Optional: true,
-			},
+		Importer: sshsession.Importer(importAuth),
 
-			"host_address": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
-			},
+		CustomizeDiff: sshsession.CustomizeHostDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
 
+		Schema: sshsession.ConnectionSchema(map[string]*schema.Schema{
 			"registry_address": &schema.Schema{
 				Type:     schema.TypeString,
 				Required: true,
@@ -55,31 +51,37 @@ func Resource() *schema.Resource {
 				Required:  true,
 				Sensitive: true,
 			},
-		},
-	}
+		}),
+	})
 }
 
-func resourceCreate(d *schema.ResourceData, m interface{}) error {
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(login(ctx, d, m))
+}
+
+func login(ctx context.Context, d *schema.ResourceData, m interface{}) error {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return err
+	}
 
 	username := d.Get("username").(string)
 	password := d.Get("password").(string)
 	registryAddress := d.Get("registry_address").(string)
 
-	cmd := []string{
-		"docker",
-		"login",
-		"-u",
-		username,
-		"-p",
-		password,
-		registryAddress,
-	}
+	ex = sshsession.Redact(ex, username, password)
 
-	line := strings.Join(cmd, " ")
+	// the password is passed through stdin, so it doesn't show up in the
+	// process list of the host
+	cmd := fmt.Sprintf(
+		"docker login -u %s --password-stdin %s",
+		shellescape.Quote(username),
+		shellescape.Quote(registryAddress),
+	)
 
-	stdout, stderr, err := sshsession.Run(d, line)
+	_, _, err = ex.RunWithStdin(ctx, cmd, strings.NewReader(password))
 	if err != nil {
-		return errors.Wrapf(err, "while running `%s`\nSTDOUT:\n%s\nSTDERR\n%s\n", line, string(stdout), string(stderr))
+		return errors.Wrapf(err, "while logging in to %s", registryAddress)
 	}
 
 	d.SetId(fmt.Sprintf("%s@%s", username, registryAddress))
@@ -87,9 +89,13 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 	return nil
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
-	stdout, _, err := sshsession.Run(d, "cat ~/.docker/config.json")
+	stdout, _, err := ex.Run(ctx, "cat ~/.docker/config.json")
 	if err != nil {
 
 		if sshsession.IsConnectTimeout(err) {
@@ -101,7 +107,7 @@ func resourceRead(d *schema.ResourceData, m interface{}) error {
 			d.SetId("")
 			return nil
 		}
-		return errors.Wrap(err, "while getting docker auth config")
+		return sshsession.Diagnostics(errors.Wrap(err, "while getting docker auth config"))
 	}
 
 	cfg := &dockerConfig{}
@@ -109,7 +115,7 @@ func resourceRead(d *schema.ResourceData, m interface{}) error {
 	err = json.Unmarshal(stdout, cfg)
 
 	if err != nil {
-		return errors.Wrap(err, "while parsing docker config file")
+		return sshsession.Diagnostics(errors.Wrap(err, "while parsing docker config file"))
 	}
 
 	registryAddress := d.Get("registry_address").(string)
@@ -123,12 +129,12 @@ func resourceRead(d *schema.ResourceData, m interface{}) error {
 
 	authString, err := base64.StdEncoding.DecodeString(authStruct.Auth)
 	if err != nil {
-		return errors.Wrapf(err, "while base64 decoding auth for %s", registryAddress)
+		return sshsession.Diagnostics(errors.Wrapf(err, "while base64 decoding auth for %s", registryAddress))
 	}
 
 	parts := strings.SplitN(string(authString), ":", 2)
 	if len(parts) != 2 {
-		return errors.Errorf("malformed auth for %s", registryAddress)
+		return diag.Errorf("malformed auth for %s", registryAddress)
 	}
 
 	d.Set("username", parts[0])
@@ -139,17 +145,29 @@ func resourceRead(d *schema.ResourceData, m interface{}) error {
 	return nil
 }
 
+// importAuth imports the credentials of the registry, which are read from
+// the docker config file.
+func importAuth(ctx context.Context, d *schema.ResourceData, m interface{}, registryAddress string) error {
+	d.SetId(registryAddress)
+	d.Set("registry_address", registryAddress)
+	return nil
+}
+
 type dockerConfig struct {
 	Auths map[string]struct {
 		Auth string `json:"auth"`
 	} `json:"auths"`
 }
 
-func resourceUpdate(d *schema.ResourceData, m interface{}) error {
-	return resourceCreate(d, m)
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(login(ctx, d, m))
 }
 
-func resourceDelete(d *schema.ResourceData, m interface{}) error {
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
 	registryAddress := d.Get("registry_address").(string)
 
@@ -161,7 +179,7 @@ func resourceDelete(d *schema.ResourceData, m interface{}) error {
 
 	line := strings.Join(cmd, " ")
 
-	stdout, stderr, err := sshsession.Run(d, line)
+	_, _, err = ex.Run(ctx, line)
 	if err != nil {
 
 		if sshsession.IsConnectTimeout(err) {
@@ -169,7 +187,7 @@ func resourceDelete(d *schema.ResourceData, m interface{}) error {
 			return nil
 		}
 
-		return errors.Wrapf(err, "while running `%s`\nSTDOUT:\n%s\nSTDERR\n%s\n", line, string(stdout), string(stderr))
+		return sshsession.Diagnostics(errors.Wrapf(err, "while logging out of %s", registryAddress))
 	}
 
 	return nil
@@ -16,16 +16,17 @@ import (
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/idtools"
 	"github.com/docker/docker/pkg/jsonmessage"
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/pkg/errors"
 )
 
 func Resource() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceCreate,
-		Read:   resourceRead,
-		Update: resourceUpdate,
-		Delete: resourceDelete,
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
 
 		Schema: map[string]*schema.Schema{
 			"source_dir": &schema.Schema{
@@ -58,10 +59,10 @@ func Resource() *schema.Resource {
 	}
 }
 
-func resourceCreate(d *schema.ResourceData, m interface{}) error {
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	dc, err := client.NewEnvClient()
 	if err != nil {
-		return errors.Wrap(err, "while creating docker client")
+		return diag.FromErr(errors.Wrap(err, "while creating docker client"))
 	}
 
 	sourceHash := d.Get("source_hash").(string)
@@ -69,21 +70,21 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 
 	imageTag := fmt.Sprintf("sourcebuild:%s", sourceHash)
 
-	ii, _, err := dc.ImageInspectWithRaw(context.Background(), imageTag)
+	ii, _, err := dc.ImageInspectWithRaw(ctx, imageTag)
 
 	if !client.IsErrNotFound(err) {
 		d.Set("image_id", ii.ID)
 		d.SetId(sourceHash)
-		return resourceRead(d, m)
+		return resourceRead(ctx, d, m)
 	}
 
 	excludes, err := build.ReadDockerignore(sourceDir)
 	if err != nil {
-		return err
+		return diag.FromErr(err)
 	}
 
 	if err := build.ValidateContextDirectory(sourceDir, excludes); err != nil {
-		return errors.Wrapf(err, "while checking context")
+		return diag.FromErr(errors.Wrapf(err, "while checking context"))
 	}
 
 	excludes = build.TrimBuildFilesFromExcludes(excludes, "Dockerfile", false)
@@ -94,7 +95,7 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 	})
 
 	if err != nil {
-		return errors.Wrap(err, "while creating tar uploader")
+		return diag.FromErr(errors.Wrap(err, "while creating tar uploader"))
 	}
 
 	defer rc.Close()
@@ -110,14 +111,14 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 		}
 	}
 
-	ibResponse, err := dc.ImageBuild(context.Background(), rc, types.ImageBuildOptions{
+	ibResponse, err := dc.ImageBuild(ctx, rc, types.ImageBuildOptions{
 		Tags:       []string{imageTag},
 		Dockerfile: d.Get("dockerfile").(string),
 		BuildArgs:  buildArgs,
 	})
 
 	if err != nil {
-		return errors.Wrap(err, "while creating tar uploader")
+		return diag.FromErr(errors.Wrap(err, "while creating tar uploader"))
 	}
 
 	defer ibResponse.Body.Close()
@@ -126,7 +127,7 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 	builtRegexp, err := regexp.Compile("^Successfully built ([0-9a-z]+)+\n$")
 
 	if err != nil {
-		return errors.Wrap(err, "while compiling regexp")
+		return diag.FromErr(errors.Wrap(err, "while compiling regexp"))
 	}
 
 	lastID := ""
@@ -141,7 +142,7 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 		}
 
 		if err != nil {
-			return errors.Wrap(err, "while reading build output")
+			return diag.FromErr(errors.Wrap(err, "while reading build output"))
 		}
 
 		matches := builtRegexp.FindStringSubmatch(msg.Stream)
@@ -153,48 +154,48 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 		}
 
 		if msg.Error != nil {
-			return errors.Errorf("error code %d building image: %s, output:\n%s", msg.Error.Code, msg.Error.Message, output.String())
+			return diag.Errorf("error code %d building image: %s, output:\n%s", msg.Error.Code, msg.Error.Message, output.String())
 		}
 	}
 
-	ii, _, err = dc.ImageInspectWithRaw(context.Background(), lastID)
+	ii, _, err = dc.ImageInspectWithRaw(ctx, lastID)
 	if err != nil {
-		return errors.Wrapf(err, "while getting image with id %s", lastID)
+		return diag.FromErr(errors.Wrapf(err, "while getting image with id %s", lastID))
 	}
 
 	err = d.Set("image_id", ii.ID)
 	if err != nil {
-		return errors.Wrap(err, "while setting image_id")
+		return diag.FromErr(errors.Wrap(err, "while setting image_id"))
 	}
 
 	d.SetId(sourceHash)
 
-	return resourceRead(d, m)
+	return resourceRead(ctx, d, m)
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	return nil
 }
 
-func resourceUpdate(d *schema.ResourceData, m interface{}) error {
-	return resourceRead(d, m)
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return resourceRead(ctx, d, m)
 }
 
-func resourceDelete(d *schema.ResourceData, m interface{}) error {
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 
 	dc, err := client.NewEnvClient()
 	if err != nil {
-		return errors.Wrap(err, "while creating docker client")
+		return diag.FromErr(errors.Wrap(err, "while creating docker client"))
 	}
 
 	imageID := d.Get("image_id").(string)
-	_, _, err = dc.ImageInspectWithRaw(context.Background(), imageID)
+	_, _, err = dc.ImageInspectWithRaw(ctx, imageID)
 
 	if client.IsErrNotFound(err) {
 		return nil
 	}
 
-	_, err = dc.ImageRemove(context.Background(), imageID, types.ImageRemoveOptions{
+	_, err = dc.ImageRemove(ctx, imageID, types.ImageRemoveOptions{
 		PruneChildren: true,
 		Force:         true,
 	})
@@ -204,7 +205,7 @@ func resourceDelete(d *schema.ResourceData, m interface{}) error {
 	}
 
 	if err != nil {
-		return errors.Wrap(err, "while deleting image")
+		return diag.FromErr(errors.Wrap(err, "while deleting image"))
 	}
 
 	return nil
@@ -1,44 +1,40 @@
 package container
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/alessio/shellescape"
 	"github.com/docker/docker/api/types"
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/numtide/terraform-provider-linuxbox/resource/docker"
 	"github.com/numtide/terraform-provider-linuxbox/sshsession"
 	"github.com/pkg/errors"
 )
 
 func Resource() *schema.Resource {
-	return &schema.Resource{
-		Create: resourceCreate,
-		Read:   resourceRead,
-		Update: resourceUpdate,
-		Delete: resourceDelete,
-
-		Schema: map[string]*schema.Schema{
-			"ssh_key": &schema.Schema{
-				Type:      schema.TypeString,
-				Required:  true,
-				Sensitive: true,
-			},
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
 
-			"ssh_user": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: false,
-				Default:  "root",
-				Optional: true,
-			},
+		Importer: sshsession.Importer(importContainer),
 
-			"host_address": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
-			},
+		CustomizeDiff: sshsession.CustomizeHostDiff,
 
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: sshsession.ConnectionSchema(map[string]*schema.Schema{
 			"image_id": &schema.Schema{
 				Type:     schema.TypeString,
 				Required: true,
@@ -138,11 +134,19 @@ func Resource() *schema.Resource {
 				Optional: true,
 				Default:  0,
 			},
-		},
-	}
+		}),
+	})
 }
 
-func resourceCreate(d *schema.ResourceData, m interface{}) error {
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(createContainer(ctx, d, m))
+}
+
+func createContainer(ctx context.Context, d *schema.ResourceData, m interface{}) error {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return err
+	}
 
 	imageID := d.Get("image_id").(string)
 
@@ -252,9 +256,9 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 
 	line := strings.Join(cmd, " ")
 
-	output, stderr, err := sshsession.Run(d, line)
+	output, _, err := ex.Run(ctx, line)
 	if err != nil {
-		return errors.Wrapf(err, "while running `%s`:\nSTDOUT:\n%s\nSTDERR:\n%s\n", line, string(output), string(stderr))
+		return errors.Wrap(err, "while running container")
 	}
 
 	outputLines := strings.Split(string(output), "\n")
@@ -268,84 +272,103 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 	d.Set("container_id", containerID)
 	d.SetId(containerID)
 
-	return resourceRead(d, m)
+	return readContainer(ctx, d, m, false)
+}
+
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(readContainer(ctx, d, m, false))
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
+// importContainer looks up the container by its ID or name. All attributes
+// are read from the container, not only the ones set in the configuration.
+func importContainer(ctx context.Context, d *schema.ResourceData, m interface{}, container string) error {
+	d.SetId(container)
+	d.Set("container_id", container)
+
+	err := readContainer(ctx, d, m, true)
+	if err != nil {
+		return err
+	}
+
+	if d.Id() == "" {
+		return errors.Errorf("container %s does not exist", container)
+	}
+
+	return nil
+}
 
+// readContainer refreshes the attributes of the container. Optional
+// attributes are only read when they are set or all is true.
+func readContainer(ctx context.Context, d *schema.ResourceData, m interface{}, all bool) error {
 	containerID := d.Get("container_id").(string)
 
 	if containerID != "" {
-		cmd := fmt.Sprintf("docker container inspect %s", containerID)
-
-		output, _, err := sshsession.Run(d, cmd)
+		output, err := docker.Inspect(ctx, d, m, "container", containerID)
 		if err != nil {
+			return err
+		}
+
+		if output == nil {
 			// container does not exist
 			name, nameIsSet := d.GetOkExists("name")
-			if nameIsSet {
-				// try inspecting by name, this can happen when `docker run` fails
-				cmd = fmt.Sprintf("docker container inspect %s", name)
-				output, _, err = sshsession.Run(d, cmd)
-				if err != nil {
-					// definitely does not exist, let the terraform know!
-					d.SetId("")
-					return nil
-				}
-
-			} else {
+			if !nameIsSet {
 				d.SetId("")
 				return nil
 			}
 
-		}
+			// try inspecting by name, this can happen when `docker run` fails
+			output, err = docker.Inspect(ctx, d, m, "container", name.(string))
+			if err != nil {
+				return err
+			}
 
-		parsed := []types.ContainerJSON{}
+			if output == nil {
+				// definitely does not exist, let the terraform know!
+				d.SetId("")
+				return nil
+			}
+		}
 
-		err = json.Unmarshal(output, &parsed)
+		containerData := types.ContainerJSON{}
 
+		err = json.Unmarshal(output, &containerData)
 		if err != nil {
 			return errors.Wrap(err, "while parsing docker container data")
 		}
 
-		if len(parsed) != 1 {
-			return errors.Errorf("Expected 1 container info for %s, but got %d", containerID, len(parsed))
-		}
-
-		containerData := parsed[0]
-
 		// this can change when we did lookup by container id and have failed but container with the name exists
 		d.SetId(containerData.ID)
 		d.Set("container_id", containerData.ID)
 
 		_, restartSet := d.GetOk("restart")
 
-		if restartSet {
+		if restartSet || all {
 			d.Set("restart", containerData.HostConfig.RestartPolicy.Name)
 		}
 
 		// inspect the image
 
 		imageID := d.Get("image_id").(string)
+		if imageID == "" {
+			imageID = containerData.Image
+		}
 
-		cmd = fmt.Sprintf("docker image inspect %s", imageID)
-		output, stderr, err := sshsession.Run(d, cmd)
+		output, err = docker.Inspect(ctx, d, m, "image", imageID)
 		if err != nil {
-			errors.Wrapf(err, "while inspecting image %s:\nSTDOUT:\n%s\nSTDERR:\n%s\n", imageID, string(output), string(stderr))
+			return err
 		}
 
-		parsedImages := []types.ImageInspect{}
+		if output == nil {
+			return errors.Errorf("image %s of container %s does not exist", imageID, containerData.ID)
+		}
 
-		err = json.Unmarshal(output, &parsedImages)
+		imageInfo := types.ImageInspect{}
 
+		err = json.Unmarshal(output, &imageInfo)
 		if err != nil {
 			return errors.Wrapf(err, "while parsing docker images data for %s", imageID)
 		}
 
-		if len(parsed) != 1 {
-			return errors.Errorf("Expected 1 container info for %s, but got %d", containerID, len(parsed))
-		}
-
-		imageInfo := parsedImages[0]
 		if imageInfo.ID != imageID {
 			if len(imageInfo.RepoTags) != 0 {
 				d.Set("image_id", imageInfo.RepoTags[0])
@@ -356,14 +379,14 @@ func resourceRead(d *schema.ResourceData, m interface{}) error {
 
 		// name
 		_, nameIsSet := d.GetOkExists("name")
-		if nameIsSet {
+		if nameIsSet || all {
 			d.Set("name", strings.TrimPrefix(containerData.Name, "/"))
 		}
 
 		// network
 		_, networkIsSet := d.GetOkExists("network")
 
-		if networkIsSet {
+		if networkIsSet || all {
 			d.Set("network", containerData.HostConfig.NetworkMode)
 		}
 
@@ -376,7 +399,7 @@ func resourceRead(d *schema.ResourceData, m interface{}) error {
 		// labels
 		_, labelsAreSet := d.GetOkExists("labels")
 
-		if labelsAreSet {
+		if labelsAreSet || all {
 			l := map[string]interface{}{}
 
 			for k, v := range containerData.Config.Labels {
@@ -393,7 +416,7 @@ func resourceRead(d *schema.ResourceData, m interface{}) error {
 		// env
 		_, envIsSet := d.GetOkExists("env")
 
-		if envIsSet {
+		if envIsSet || all {
 
 			env := map[string]interface{}{}
 
@@ -420,7 +443,7 @@ func resourceRead(d *schema.ResourceData, m interface{}) error {
 
 		// caps
 		_, capsAreSet := d.GetOkExists("caps")
-		if capsAreSet {
+		if capsAreSet || all {
 			caps := []interface{}{}
 			for _, c := range containerData.HostConfig.CapAdd {
 				caps = append(caps, c)
@@ -431,7 +454,7 @@ func resourceRead(d *schema.ResourceData, m interface{}) error {
 		// volumes
 		_, volumesAreSet := d.GetOkExists("volumes")
 
-		if volumesAreSet {
+		if volumesAreSet || all {
 			vols := []interface{}{}
 			for _, b := range containerData.HostConfig.Binds {
 				vols = append(vols, b)
@@ -442,7 +465,7 @@ func resourceRead(d *schema.ResourceData, m interface{}) error {
 		// ports
 		_, portsAreSet := d.GetOkExists("ports")
 
-		if portsAreSet {
+		if portsAreSet || all {
 			ports := []interface{}{}
 			for port, bindings := range containerData.HostConfig.PortBindings {
 				postfix := ""
@@ -491,22 +514,34 @@ func resourceRead(d *schema.ResourceData, m interface{}) error {
 	return nil
 }
 
-func resourceUpdate(d *schema.ResourceData, m interface{}) error {
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	if sshsession.OnlyConnectionChanged(d, Resource().Schema) {
+		return resourceRead(ctx, d, m)
+	}
+
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
 	containerID := d.Get("container_id").(string)
 
 	if containerID != "" {
 		cmd := fmt.Sprintf("docker rm -fv %s", containerID)
-		output, stderr, err := sshsession.Run(d, cmd)
+		_, _, err := ex.Run(ctx, cmd)
 		if err != nil {
-			return errors.Wrapf(err, "while running `%s`:\nSTDOUT:\n%s\nSTDERR:\n%s\n", cmd, string(output), string(stderr))
+			return sshsession.Diagnostics(errors.Wrapf(err, "while removing container %s", containerID))
 		}
 	}
 
-	return resourceCreate(d, m)
+	return sshsession.Diagnostics(createContainer(ctx, d, m))
 }
 
-func resourceDelete(d *schema.ResourceData, m interface{}) error {
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
 	cmd := []string{
 		"docker",
@@ -517,9 +552,9 @@ func resourceDelete(d *schema.ResourceData, m interface{}) error {
 
 	line := strings.Join(cmd, " ")
 
-	output, stderr, err := sshsession.Run(d, line)
+	_, _, err = ex.Run(ctx, line)
 	if err != nil {
-		return errors.Wrapf(err, "while running `%s`:\nSTDOUT:\n%s\nSTDERR:\n%s\n", line, string(output), string(stderr))
+		return sshsession.Diagnostics(errors.Wrapf(err, "while removing container %s", d.Id()))
 	}
 
 	return nil
@@ -2,80 +2,76 @@ package copyimage
 
 import (
 	"context"
+	"time"
 
 	"github.com/docker/docker/client"
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/numtide/terraform-provider-linuxbox/sshsession"
 	"github.com/pkg/errors"
 )
 
 func Resource() *schema.Resource {
-	return &schema.Resource{
-		Create: resourceCreate,
-		Read:   resourceRead,
-		Update: resourceUpdate,
-		Delete: resourceDelete,
-
-		Schema: map[string]*schema.Schema{
-			"host_address": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
-			},
-			"ssh_key": &schema.Schema{
-				Type:      schema.TypeString,
-				Required:  true,
-				Sensitive: true,
-			},
-			"ssh_user": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: false,
-				Default:  "root",
-				Optional: true,
-			},
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
+
+		CustomizeDiff: sshsession.CustomizeHostDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: sshsession.ConnectionSchema(map[string]*schema.Schema{
 			"image_id": &schema.Schema{
 				Type:     schema.TypeString,
 				Required: true,
 				ForceNew: true,
 			},
-		},
-	}
+		}),
+	})
 }
 
-func resourceCreate(d *schema.ResourceData, m interface{}) error {
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
 	dc, err := client.NewEnvClient()
 	if err != nil {
-		return errors.Wrap(err, "while creating docker client")
+		return sshsession.Diagnostics(errors.Wrap(err, "while creating docker client"))
 	}
 
 	imageID := d.Get("image_id").(string)
 
-	rc, err := dc.ImageSave(context.Background(), []string{imageID})
+	rc, err := dc.ImageSave(ctx, []string{imageID})
 	if err != nil {
-		return errors.Wrapf(err, "while saving image %s", imageID)
+		return sshsession.Diagnostics(errors.Wrapf(err, "while saving image %s", imageID))
 	}
 
 	defer rc.Close()
 
-	output, stderr, err := sshsession.RunWithStdin(d, "docker load", rc)
+	_, _, err = ex.RunWithStdin(ctx, "docker load", rc)
 	if err != nil {
-		return errors.Wrapf(err, "error while executing `docker load` via ssh STDOUT:\n%s\nSTDERR:%s\n", string(output), string(stderr))
+		return sshsession.Diagnostics(errors.Wrapf(err, "while loading image %s", imageID))
 	}
 
 	d.SetId(imageID)
 
-	return resourceRead(d, m)
+	return resourceRead(ctx, d, m)
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	return nil
 }
 
-func resourceUpdate(d *schema.ResourceData, m interface{}) error {
-	return resourceRead(d, m)
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return resourceRead(ctx, d, m)
 }
 
-func resourceDelete(d *schema.ResourceData, m interface{}) error {
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	return nil
 }
@@ -1,47 +1,44 @@
 package docker
 
 import (
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"context"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/numtide/terraform-provider-linuxbox/sshsession"
 	"github.com/pkg/errors"
 )
 
 func Resource() *schema.Resource {
-	return &schema.Resource{
-		Create:             resourceCreate,
-		Read:               resourceRead,
-		Update:             resourceUpdate,
-		Delete:             resourceDelete,
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext:      resourceCreate,
+		ReadContext:        resourceRead,
+		UpdateContext:      resourceUpdate,
+		DeleteContext:      resourceDelete,
 		DeprecationMessage: "This resource is deprecated, please use linuxbox_run_setup instead",
 
-		Schema: map[string]*schema.Schema{
-			"host_address": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
-			},
-			"ssh_key": &schema.Schema{
-				Type:      schema.TypeString,
-				Required:  true,
-				Sensitive: true,
-			},
-			"ssh_user": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: false,
-				Default:  "root",
-				Optional: true,
-			},
+		CustomizeDiff: sshsession.CustomizeHostDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
 		},
-	}
+
+		Schema: sshsession.ConnectionSchema(map[string]*schema.Schema{}),
+	})
 }
 
-func resourceCreate(d *schema.ResourceData, m interface{}) error {
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
 	line := "which docker || true"
 
-	stdout, stderr, err := sshsession.Run(d, line)
+	stdout, _, err := ex.Run(ctx, line)
 	if err != nil {
-		return errors.Wrapf(err, "while running `%s`\nstdout:\n%s\nstderr:\n%s\n", line, string(stdout), string(stderr))
+		return sshsession.Diagnostics(errors.Wrap(err, "while looking for docker"))
 	}
 
 	if string(stdout) == "" {
@@ -55,9 +52,9 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 		}
 
 		for _, cmd := range commands {
-			stdout, stderr, err := sshsession.Run(d, cmd)
+			_, _, err := ex.Run(ctx, cmd)
 			if err != nil {
-				return errors.Wrapf(err, "while running `%s`\nstdout:\n%s\nstderr:\n%s\n", cmd, string(stdout), string(stderr))
+				return sshsession.Diagnostics(errors.Wrap(err, "while installing docker"))
 			}
 		}
 
@@ -68,18 +65,18 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 
 	// return errors.Errorf("output %q", string(output))
 
-	return resourceRead(d, m)
+	return resourceRead(ctx, d, m)
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	return nil
 }
 
-func resourceUpdate(d *schema.ResourceData, m interface{}) error {
-	return resourceRead(d, m)
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return resourceRead(ctx, d, m)
 }
 
-func resourceDelete(d *schema.ResourceData, m interface{}) error {
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	// TODO add removing docker
 	return nil
 }
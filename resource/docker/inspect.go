@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession"
+	"github.com/pkg/errors"
+)
+
+// Inspect returns the JSON description of the docker object (e.g.
+// "container" or "image") ref on the host of the resource d, or nil when it
+// does not exist. Concurrent inspections of the same kind of object on the
+// same host are run in a single session.
+func Inspect(ctx context.Context, d *schema.ResourceData, m interface{}, object, ref string) ([]byte, error) {
+	out, err := sshsession.Batch(ctx, d, m, "docker "+object+" inspect", ref, func(ctx context.Context, ex sshsession.Executor, refs []string) ([][]byte, error) {
+		return inspectBatch(ctx, ex, object, refs)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "while inspecting %s %s", object, ref)
+	}
+
+	return out, nil
+}
+
+func inspectBatch(ctx context.Context, ex sshsession.Executor, object string, refs []string) ([][]byte, error) {
+	quoted := make([]string, len(refs))
+	for i, r := range refs {
+		quoted[i] = shellescape.Quote(r)
+	}
+
+	// one line per ref, `{{json .}}` prints the object on a single line
+	cmd := fmt.Sprintf(
+		`for r in %s; do if out=$(docker %s inspect --format '{{json .}}' "$r" 2>/dev/null); then printf '%%s\n' "$out"; else echo -; fi; done`,
+		strings.Join(quoted, " "),
+		object,
+	)
+
+	return sshsession.RunBatch(ctx, ex, cmd, len(refs))
+}
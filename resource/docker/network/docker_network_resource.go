@@ -1,53 +1,52 @@
 package network
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/alessio/shellescape"
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/numtide/terraform-provider-linuxbox/resource/docker"
 	"github.com/numtide/terraform-provider-linuxbox/sshsession"
 	"github.com/pkg/errors"
 )
 
 func Resource() *schema.Resource {
-	return &schema.Resource{
-		Create: resourceCreate,
-		Read:   resourceRead,
-		Update: resourceUpdate,
-		Delete: resourceDelete,
-
-		Schema: map[string]*schema.Schema{
-			"ssh_key": &schema.Schema{
-				Type:      schema.TypeString,
-				Required:  true,
-				Sensitive: true,
-			},
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
 
-			"ssh_user": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: false,
-				Default:  "root",
-				Optional: true,
-			},
+		Importer: sshsession.Importer(importNetwork),
 
-			"host_address": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
-			},
+		CustomizeDiff: sshsession.CustomizeHostDiff,
 
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: sshsession.ConnectionSchema(map[string]*schema.Schema{
 			"name": &schema.Schema{
 				Type:     schema.TypeString,
 				Required: true,
 				ForceNew: true,
 			},
-		},
-	}
+		}),
+	})
 }
 
-func resourceCreate(d *schema.ResourceData, m interface{}) error {
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
 	name := d.Get("name").(string)
 
@@ -60,9 +59,9 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 
 	line := strings.Join(cmd, " ")
 
-	stdout, stderr, err := sshsession.Run(d, line)
+	stdout, _, err := ex.Run(ctx, line)
 	if err != nil {
-		return errors.Wrapf(err, "while running `%s`: %s", line, string(stderr))
+		return sshsession.Diagnostics(errors.Wrapf(err, "while creating network %s", name))
 	}
 
 	id := strings.TrimSuffix(string(stdout), "\n")
@@ -72,10 +71,13 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 	return nil
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	output, err := docker.Inspect(ctx, d, m, "network", d.Id())
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
-	stdout, _, err := sshsession.Run(d, fmt.Sprintf("docker network inspect %s", d.Id()))
-	if sshsession.IsExecError(err) {
+	if output == nil {
 		d.SetId("")
 		return nil
 	}
@@ -85,36 +87,46 @@ func resourceRead(d *schema.ResourceData, m interface{}) error {
 		Name string `json:"Name"`
 	}
 
-	networks := []network{}
-
-	err = json.Unmarshal(stdout, &networks)
+	n := network{}
 
+	err = json.Unmarshal(output, &n)
 	if err != nil {
-		return errors.Wrap(err, "while parsing docker network json")
+		return sshsession.Diagnostics(errors.Wrap(err, "while parsing docker network json"))
 	}
 
-	if len(networks) != 1 {
-		return errors.Errorf("expected one network with id %s, found %d", d.Id(), len(networks))
-	}
+	// imported networks can be identified by their name
+	d.SetId(n.ID)
+	d.Set("name", n.Name)
 
-	d.Set("name", networks[0].Name)
+	return nil
+}
 
+// importNetwork imports the network by its ID or name.
+func importNetwork(ctx context.Context, d *schema.ResourceData, m interface{}, network string) error {
+	d.SetId(network)
 	return nil
 }
 
-func resourceUpdate(d *schema.ResourceData, m interface{}) error {
-	return errors.New("update is not supported")
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	if sshsession.OnlyConnectionChanged(d, Resource().Schema) {
+		return resourceRead(ctx, d, m)
+	}
+
+	return diag.Errorf("update is not supported")
 }
 
-func resourceDelete(d *schema.ResourceData, m interface{}) error {
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
 	cmd := fmt.Sprintf("docker network rm %s", d.Id())
 
-	stdout, stderr, err := sshsession.Run(d, cmd)
-
+	_, _, err = ex.Run(ctx, cmd)
 	if err != nil {
-		errors.Wrapf(err, "error while executing `%s` via ssh STDOUT:\n%s\nSTDERR:%s\n", cmd, string(stdout), string(stderr))
+		return sshsession.Diagnostics(errors.Wrapf(err, "while deleting network %s", d.Id()))
 	}
 
-	return err
+	return nil
 }
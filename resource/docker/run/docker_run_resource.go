@@ -1,42 +1,32 @@
 package run
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/alessio/shellescape"
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/numtide/terraform-provider-linuxbox/sshsession"
 	"github.com/pkg/errors"
 )
 
 func Resource() *schema.Resource {
-	return &schema.Resource{
-		Create: resourceCreate,
-		Read:   resourceRead,
-		Update: resourceUpdate,
-		Delete: resourceDelete,
-
-		Schema: map[string]*schema.Schema{
-			"ssh_key": &schema.Schema{
-				Type:      schema.TypeString,
-				Required:  true,
-				Sensitive: true,
-			},
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
 
-			"ssh_user": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: false,
-				Default:  "root",
-				Optional: true,
-			},
+		CustomizeDiff: sshsession.CustomizeHostDiff,
 
-			"host_address": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
-			},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+		},
 
+		Schema: sshsession.ConnectionSchema(map[string]*schema.Schema{
 			"image_id": &schema.Schema{
 				Type:     schema.TypeString,
 				Required: true,
@@ -126,11 +116,15 @@ func Resource() *schema.Resource {
 				Computed:  true,
 				Sensitive: true,
 			},
-		},
-	}
+		}),
+	})
 }
 
-func resourceCreate(d *schema.ResourceData, m interface{}) error {
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
 	imageID := d.Get("image_id").(string)
 
@@ -217,9 +211,9 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 
 	line := strings.Join(cmd, " ")
 
-	stdout, stderr, err := sshsession.Run(d, line)
+	stdout, stderr, err := ex.Run(ctx, line)
 	if err != nil {
-		return errors.Wrapf(err, "while running `%s`\nstdout:\n%s\nstderr:\n%s\n", line, string(stdout), string(stderr))
+		return sshsession.Diagnostics(errors.Wrap(err, "while running container"))
 	}
 
 	d.SetId("success")
@@ -229,16 +223,16 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 	return nil
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 
 	return nil
 }
 
-func resourceUpdate(d *schema.ResourceData, m interface{}) error {
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	return nil
 }
 
-func resourceDelete(d *schema.ResourceData, m interface{}) error {
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 
 	return nil
 }
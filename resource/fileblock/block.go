@@ -0,0 +1,99 @@
+package fileblock
+
+import (
+	"regexp"
+
+	"github.com/numtide/terraform-provider-linuxbox/sshsession"
+)
+
+// block describes a block of lines between a begin and an end marker.
+type block struct {
+	begin string
+	end   string
+
+	lines []string
+
+	// a missing block is inserted after the last line matching
+	// insertAfter, or before the first line matching insertBefore, and
+	// otherwise at the end of the file.
+	insertAfter  *regexp.Regexp
+	insertBefore *regexp.Regexp
+}
+
+// find returns the index of the begin and end markers of the block in
+// lines.
+func (b *block) find(lines []string) (int, int, bool) {
+	for i, l := range lines {
+		if l != b.begin {
+			continue
+		}
+
+		for j := i + 1; j < len(lines); j++ {
+			if lines[j] == b.end {
+				return i, j, true
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+// current returns the lines of the block in content, and false when content
+// has no block.
+func (b *block) current(content []byte) ([]string, bool) {
+	lines := sshsession.SplitLines(content)
+
+	begin, end, found := b.find(lines)
+	if !found {
+		return nil, false
+	}
+
+	return lines[begin+1 : end], true
+}
+
+// apply is a sshsession.EditFunc writing the block into content.
+func (b *block) apply(content []byte) ([]byte, error) {
+	lines := sshsession.SplitLines(content)
+
+	withMarkers := append(append([]string{b.begin}, b.lines...), b.end)
+
+	begin, end, found := b.find(lines)
+	if found {
+		if equalLines(lines[begin+1:end], b.lines) {
+			return content, nil
+		}
+
+		lines = append(lines[:begin], append(withMarkers, lines[end+1:]...)...)
+		return sshsession.JoinLines(lines), nil
+	}
+
+	lines = sshsession.InsertLines(lines, withMarkers, b.insertAfter, b.insertBefore)
+	return sshsession.JoinLines(lines), nil
+}
+
+// remove is a sshsession.EditFunc removing the block, markers included, from
+// content.
+func (b *block) remove(content []byte) ([]byte, error) {
+	lines := sshsession.SplitLines(content)
+
+	begin, end, found := b.find(lines)
+	if !found {
+		return content, nil
+	}
+
+	return sshsession.JoinLines(append(lines[:begin], lines[end+1:]...)), nil
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
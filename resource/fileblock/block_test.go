@@ -0,0 +1,80 @@
+package fileblock
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestBlockApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		block   block
+		content string
+		want    string
+	}{
+		{
+			name:    "append",
+			block:   block{lines: []string{"a", "b"}},
+			content: "x\n",
+			want:    "x\n# BEGIN\na\nb\n# END\n",
+		},
+		{
+			name:    "replace",
+			block:   block{lines: []string{"c"}},
+			content: "x\n# BEGIN\na\nb\n# END\ny\n",
+			want:    "x\n# BEGIN\nc\n# END\ny\n",
+		},
+		{
+			name:    "unchanged",
+			block:   block{lines: []string{"a"}},
+			content: "x\n# BEGIN\na\n# END",
+			want:    "x\n# BEGIN\na\n# END",
+		},
+		{
+			name:    "begin without end",
+			block:   block{lines: []string{"a"}},
+			content: "# BEGIN\nx\n",
+			want:    "# BEGIN\nx\n# BEGIN\na\n# END\n",
+		},
+		{
+			name:    "insert before",
+			block:   block{lines: []string{"a"}, insertBefore: regexp.MustCompile(`^# End of file`)},
+			content: "x\n# End of file\n",
+			want:    "x\n# BEGIN\na\n# END\n# End of file\n",
+		},
+		{
+			name:    "insert after",
+			block:   block{lines: []string{"a"}, insertAfter: regexp.MustCompile(`^x`)},
+			content: "x\ny\n",
+			want:    "x\n# BEGIN\na\n# END\ny\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.block.begin, tt.block.end = "# BEGIN", "# END"
+
+			got, err := tt.block.apply([]byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBlockRemove(t *testing.T) {
+	b := block{begin: "# BEGIN", end: "# END"}
+
+	got, err := b.remove([]byte("x\n# BEGIN\na\n# END\ny\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != "x\ny\n" {
+		t.Errorf("expected the block to be removed, got %q", got)
+	}
+}
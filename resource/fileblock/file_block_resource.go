@@ -0,0 +1,186 @@
+package fileblock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession"
+	"github.com/pkg/errors"
+)
+
+func Resource() *schema.Resource {
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
+
+		CustomizeDiff: sshsession.CustomizeHostDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: sshsession.ConnectionSchema(map[string]*schema.Schema{
+			"path": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			"marker": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+				ValidateDiagFunc: validation.ToDiagFunc(
+					validation.StringDoesNotContainAny("\n"),
+				),
+			},
+
+			"comment": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "#",
+				ForceNew: true,
+				ValidateDiagFunc: validation.ToDiagFunc(
+					validation.StringDoesNotContainAny("\n"),
+				),
+			},
+
+			"content": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+
+			"insert_after": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ConflictsWith:    []string{"insert_before"},
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringIsValidRegExp),
+			},
+
+			"insert_before": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ConflictsWith:    []string{"insert_after"},
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringIsValidRegExp),
+			},
+
+			"create": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+		}),
+	})
+}
+
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(resourceUpdateAndCreate(ctx, d, m))
+}
+
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(resourceUpdateAndCreate(ctx, d, m))
+}
+
+func resourceUpdateAndCreate(ctx context.Context, d *schema.ResourceData, m interface{}) error {
+	path := d.Get("path").(string)
+
+	b, err := blockFor(d)
+	if err != nil {
+		return err
+	}
+
+	err = sshsession.EditFile(ctx, d, m, path, d.Get("create").(bool), b.apply)
+	if err != nil {
+		return errors.Wrapf(err, "while editing file %q", path)
+	}
+
+	sum := sha256.Sum256([]byte(path + "\n" + b.begin))
+	d.SetId(hex.EncodeToString(sum[:]))
+
+	return nil
+}
+
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	path := d.Get("path").(string)
+
+	b, err := blockFor(d)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
+
+	content, err := sshsession.ReadFile(ctx, d, m, path)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
+
+	current, found := b.current(content)
+	if !found {
+		// the file or the block does not exist anymore
+		d.SetId("")
+		return nil
+	}
+
+	// only the block is compared, the rest of the file belongs to others
+	if !equalLines(current, b.lines) {
+		d.Set("content", string(sshsession.JoinLines(current)))
+	}
+
+	return nil
+}
+
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	path := d.Get("path").(string)
+
+	b, err := blockFor(d)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
+
+	err = sshsession.EditFile(ctx, d, m, path, false, b.remove)
+	if err != nil {
+		return sshsession.Diagnostics(errors.Wrapf(err, "while editing file %q", path))
+	}
+
+	return nil
+}
+
+func blockFor(d *schema.ResourceData) (*block, error) {
+	comment := d.Get("comment").(string)
+	marker := d.Get("marker").(string)
+
+	b := &block{
+		begin: fmt.Sprintf("%s BEGIN %s", comment, marker),
+		end:   fmt.Sprintf("%s END %s", comment, marker),
+		lines: sshsession.SplitLines([]byte(d.Get("content").(string))),
+	}
+
+	for attribute, re := range map[string]**regexp.Regexp{
+		"insert_after":  &b.insertAfter,
+		"insert_before": &b.insertBefore,
+	} {
+		expr := d.Get(attribute).(string)
+		if expr == "" {
+			continue
+		}
+
+		var err error
+		*re, err = regexp.Compile(expr)
+		if err != nil {
+			return nil, &sshsession.AttributeError{Attribute: attribute, Err: errors.Wrapf(err, "while parsing %s", attribute)}
+		}
+	}
+
+	return b, nil
+}
@@ -0,0 +1,89 @@
+package fileblock
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession/sshtest"
+)
+
+func TestAccFileBlock(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	path := srv.Path("limits.conf")
+
+	err := ioutil.WriteFile(path, []byte("* soft core 0\n# End of file\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := func(content string) string {
+		return fmt.Sprintf(`
+resource "linuxbox_file_block" "test" {
+  %s
+  path          = %q
+  marker        = "app"
+  content       = %q
+  insert_before = "^# End of file"
+}
+`, srv.Config(), path, content)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: sshtest.ProviderFactories(map[string]*schema.Resource{
+			"linuxbox_file_block": Resource(),
+		}),
+		CheckDestroy: testCheckContent(path, "* soft core 0\n# End of file\n"),
+		Steps: []resource.TestStep{
+			{
+				Config: config("app soft nofile 1024\napp hard nofile 4096\n"),
+				Check:  testCheckContent(path, "* soft core 0\n# BEGIN app\napp soft nofile 1024\napp hard nofile 4096\n# END app\n# End of file\n"),
+			},
+			{
+				Config: config("app soft nofile 2048\n"),
+				Check:  testCheckContent(path, "* soft core 0\n# BEGIN app\napp soft nofile 2048\n# END app\n# End of file\n"),
+			},
+			{
+				// the block is changed behind the back of terraform, the
+				// rest of the file is left alone
+				PreConfig: func() {
+					err := ioutil.WriteFile(path, []byte("* soft core 1\n# BEGIN app\napp soft nofile 1\n# END app\n# End of file\n"), 0644)
+					if err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config("app soft nofile 2048\n"),
+				Check:  testCheckContent(path, "* soft core 1\n# BEGIN app\napp soft nofile 2048\n# END app\n# End of file\n"),
+			},
+			{
+				// changes outside of the block are no drift
+				PreConfig: func() {
+					err := ioutil.WriteFile(path, []byte("* soft core 0\n# BEGIN app\napp soft nofile 2048\n# END app\n# End of file\n"), 0644)
+					if err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config:   config("app soft nofile 2048\n"),
+				PlanOnly: true,
+			},
+		},
+	})
+}
+
+func testCheckContent(path, content string) resource.TestCheckFunc {
+	return func(*terraform.State) error {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if string(data) != content {
+			return fmt.Errorf("expected content %q of %s, got %q", content, path, data)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,223 @@
+package lineinfile
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession"
+	"github.com/pkg/errors"
+)
+
+func Resource() *schema.Resource {
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
+
+		CustomizeDiff: customdiff.Sequence(sshsession.CustomizeHostDiff, customizeDiff),
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
+		Schema: sshsession.ConnectionSchema(map[string]*schema.Schema{
+			"path": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			"line": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				AtLeastOneOf: []string{"line", "regexp"},
+				ValidateDiagFunc: validation.ToDiagFunc(
+					validation.StringDoesNotContainAny("\n"),
+				),
+			},
+
+			"regexp": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				AtLeastOneOf:     []string{"line", "regexp"},
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringIsValidRegExp),
+			},
+
+			"insert_after": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ConflictsWith:    []string{"insert_before"},
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringIsValidRegExp),
+			},
+
+			"insert_before": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ConflictsWith:    []string{"insert_after"},
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringIsValidRegExp),
+			},
+
+			"state": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "present",
+				ValidateDiagFunc: validation.ToDiagFunc(
+					validation.StringInSlice([]string{"present", "absent"}, false),
+				),
+			},
+
+			"create": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			"in_sync": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+		}),
+	})
+}
+
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(resourceUpdateAndCreate(ctx, d, m))
+}
+
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(resourceUpdateAndCreate(ctx, d, m))
+}
+
+func resourceUpdateAndCreate(ctx context.Context, d *schema.ResourceData, m interface{}) error {
+	path := d.Get("path").(string)
+
+	s, err := specFor(d)
+	if err != nil {
+		return err
+	}
+
+	oldLine, _ := d.GetChange("line")
+	oldState, _ := d.GetChange("state")
+
+	// a changed line replaces the previous one in place
+	if !d.IsNewResource() && oldState == "present" && oldLine != s.line && s.regexp == nil {
+		s.regexp = regexp.MustCompile("^" + regexp.QuoteMeta(oldLine.(string)) + "$")
+	}
+
+	err = sshsession.EditFile(ctx, d, m, path, d.Get("create").(bool), s.apply)
+	if err != nil {
+		return errors.Wrapf(err, "while editing file %q", path)
+	}
+
+	d.Set("in_sync", true)
+
+	if d.IsNewResource() {
+		sum := sha256.Sum256([]byte(path + "\n" + s.line))
+		d.SetId(hex.EncodeToString(sum[:]))
+	}
+
+	return nil
+}
+
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	path := d.Get("path").(string)
+
+	s, err := specFor(d)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
+
+	content, err := sshsession.ReadFile(ctx, d, m, path)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
+
+	edited, err := s.apply(content)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
+
+	// a missing file, or a line changed on the host, is restored by the
+	// update customizeDiff plans
+	d.Set("in_sync", bytes.Equal(edited, content))
+
+	return nil
+}
+
+// customizeDiff plans an update when the line drifted, and requires a line
+// to ensure.
+func customizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if d.Get("state").(string) == "present" && d.NewValueKnown("line") && d.Get("line").(string) == "" {
+		return errors.New("line is required when state is present")
+	}
+
+	if d.Id() != "" && !d.Get("in_sync").(bool) {
+		return d.SetNew("in_sync", true)
+	}
+
+	return nil
+}
+
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	if d.Get("state").(string) != "present" {
+		// removed lines are not restored
+		return nil
+	}
+
+	path := d.Get("path").(string)
+
+	s := &spec{line: d.Get("line").(string)}
+	if s.line == "" {
+		// removing it would remove all the blank lines of the file
+		return nil
+	}
+
+	err := sshsession.EditFile(ctx, d, m, path, false, s.remove)
+	if err != nil {
+		return sshsession.Diagnostics(errors.Wrapf(err, "while editing file %q", path))
+	}
+
+	return nil
+}
+
+func specFor(d *schema.ResourceData) (*spec, error) {
+	s := &spec{
+		line:    d.Get("line").(string),
+		present: d.Get("state").(string) == "present",
+	}
+
+	if s.present && s.line == "" {
+		return nil, &sshsession.AttributeError{Attribute: "line", Err: errors.New("line is required when state is present")}
+	}
+
+	for attribute, re := range map[string]**regexp.Regexp{
+		"regexp":        &s.regexp,
+		"insert_after":  &s.insertAfter,
+		"insert_before": &s.insertBefore,
+	} {
+		expr := d.Get(attribute).(string)
+		if expr == "" {
+			continue
+		}
+
+		var err error
+		*re, err = regexp.Compile(expr)
+		if err != nil {
+			return nil, &sshsession.AttributeError{Attribute: attribute, Err: errors.Wrapf(err, "while parsing %s", attribute)}
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,86 @@
+package lineinfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession/sshtest"
+)
+
+func TestAccLineInFile(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	path := srv.Path("sshd_config")
+
+	err := ioutil.WriteFile(path, []byte("Port 22\n#PermitRootLogin yes\nUsePAM yes\n"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := func(line string) string {
+		return fmt.Sprintf(`
+resource "linuxbox_line_in_file" "test" {
+  %s
+  path   = %q
+  line   = %q
+  regexp = "^#?PermitRootLogin "
+}
+`, srv.Config(), path, line)
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: sshtest.ProviderFactories(map[string]*schema.Resource{
+			"linuxbox_line_in_file": Resource(),
+		}),
+		CheckDestroy: testCheckContent(path, "Port 22\nUsePAM yes\n"),
+		Steps: []resource.TestStep{
+			{
+				Config: config("PermitRootLogin no"),
+				Check:  testCheckContent(path, "Port 22\nPermitRootLogin no\nUsePAM yes\n"),
+			},
+			{
+				Config: config("PermitRootLogin prohibit-password"),
+				Check:  testCheckContent(path, "Port 22\nPermitRootLogin prohibit-password\nUsePAM yes\n"),
+			},
+			{
+				// the line is changed behind the back of terraform
+				PreConfig: func() {
+					err := ioutil.WriteFile(path, []byte("Port 22\nPermitRootLogin yes\nUsePAM yes\n"), 0640)
+					if err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config("PermitRootLogin prohibit-password"),
+				Check:  testCheckContent(path, "Port 22\nPermitRootLogin prohibit-password\nUsePAM yes\n"),
+			},
+		},
+	})
+}
+
+func testCheckContent(path, content string) resource.TestCheckFunc {
+	return func(*terraform.State) error {
+		st, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if st.Mode().Perm() != 0640 {
+			return fmt.Errorf("expected mode 640 of %s, got %o", path, st.Mode().Perm())
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if string(data) != content {
+			return fmt.Errorf("expected content %q of %s, got %q", content, path, data)
+		}
+
+		return nil
+	}
+}
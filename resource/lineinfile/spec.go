@@ -0,0 +1,96 @@
+package lineinfile
+
+import (
+	"regexp"
+
+	"github.com/numtide/terraform-provider-linuxbox/sshsession"
+)
+
+// spec describes how a line is managed in a file.
+type spec struct {
+	line    string
+	present bool
+
+	// regexp matches the lines which are replaced by line when present, or
+	// removed when absent.
+	regexp *regexp.Regexp
+
+	// a missing line is inserted after the last line matching insertAfter,
+	// or before the first line matching insertBefore, and otherwise at the
+	// end of the file.
+	insertAfter  *regexp.Regexp
+	insertBefore *regexp.Regexp
+}
+
+// apply is a sshsession.EditFunc ensuring the line is present or absent.
+func (s *spec) apply(content []byte) ([]byte, error) {
+	lines := sshsession.SplitLines(content)
+
+	var changed bool
+	if s.present {
+		lines, changed = s.ensure(lines)
+	} else {
+		lines, changed = s.filter(lines, s.matches)
+	}
+
+	if !changed {
+		return content, nil
+	}
+
+	return sshsession.JoinLines(lines), nil
+}
+
+// remove is a sshsession.EditFunc removing the lines equal to line.
+func (s *spec) remove(content []byte) ([]byte, error) {
+	lines, changed := s.filter(sshsession.SplitLines(content), func(l string) bool {
+		return l == s.line
+	})
+
+	if !changed {
+		return content, nil
+	}
+
+	return sshsession.JoinLines(lines), nil
+}
+
+func (s *spec) matches(l string) bool {
+	if s.regexp != nil {
+		return s.regexp.MatchString(l)
+	}
+	return l == s.line
+}
+
+func (s *spec) ensure(lines []string) ([]string, bool) {
+	if s.regexp != nil {
+		// the last match is replaced
+		for i := len(lines) - 1; i >= 0; i-- {
+			if s.regexp.MatchString(lines[i]) {
+				if lines[i] == s.line {
+					return lines, false
+				}
+				lines[i] = s.line
+				return lines, true
+			}
+		}
+	}
+
+	for _, l := range lines {
+		if l == s.line {
+			return lines, false
+		}
+	}
+
+	lines = sshsession.InsertLines(lines, []string{s.line}, s.insertAfter, s.insertBefore)
+	return lines, true
+}
+
+func (s *spec) filter(lines []string, drop func(string) bool) ([]string, bool) {
+	kept := []string{}
+	for _, l := range lines {
+		if !drop(l) {
+			kept = append(kept, l)
+		}
+	}
+
+	return kept, len(kept) != len(lines)
+}
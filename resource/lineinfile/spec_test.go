@@ -0,0 +1,108 @@
+package lineinfile
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSpecApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    spec
+		content string
+		want    string
+	}{
+		{
+			name:    "append",
+			spec:    spec{line: "c", present: true},
+			content: "a\nb\n",
+			want:    "a\nb\nc\n",
+		},
+		{
+			name:    "append without final newline",
+			spec:    spec{line: "c", present: true},
+			content: "a\nb",
+			want:    "a\nb\nc\n",
+		},
+		{
+			name:    "already present",
+			spec:    spec{line: "b", present: true},
+			content: "a\nb",
+			want:    "a\nb",
+		},
+		{
+			name:    "create",
+			spec:    spec{line: "a", present: true},
+			content: "",
+			want:    "a\n",
+		},
+		{
+			name:    "replace last match",
+			spec:    spec{line: "PermitRootLogin no", present: true, regexp: regexp.MustCompile(`^#?PermitRootLogin`)},
+			content: "#PermitRootLogin yes\nPort 22\nPermitRootLogin yes\n",
+			want:    "#PermitRootLogin yes\nPort 22\nPermitRootLogin no\n",
+		},
+		{
+			name:    "insert after last match",
+			spec:    spec{line: "x", present: true, insertAfter: regexp.MustCompile(`^\[`)},
+			content: "[a]\n1\n[b]\n2\n",
+			want:    "[a]\n1\n[b]\nx\n2\n",
+		},
+		{
+			name:    "insert before first match",
+			spec:    spec{line: "x", present: true, insertBefore: regexp.MustCompile(`^\[`)},
+			content: "1\n[a]\n[b]\n",
+			want:    "1\nx\n[a]\n[b]\n",
+		},
+		{
+			name:    "insert without marker",
+			spec:    spec{line: "x", present: true, insertBefore: regexp.MustCompile(`^\[`)},
+			content: "1\n",
+			want:    "1\nx\n",
+		},
+		{
+			name:    "absent",
+			spec:    spec{line: "b"},
+			content: "a\nb\nc\nb\n",
+			want:    "a\nc\n",
+		},
+		{
+			name:    "absent by regexp",
+			spec:    spec{line: "", regexp: regexp.MustCompile(`^#`)},
+			content: "#a\nb\n#c\n",
+			want:    "b\n",
+		},
+		{
+			name:    "already absent",
+			spec:    spec{line: "x"},
+			content: "a\nb",
+			want:    "a\nb",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.spec.apply([]byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSpecRemove(t *testing.T) {
+	s := spec{line: "b", present: true, regexp: regexp.MustCompile(`.`)}
+
+	got, err := s.remove([]byte("a\nb\nbb\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != "a\nbb\n" {
+		t.Errorf("expected only the line itself to be removed, got %q", got)
+	}
+}
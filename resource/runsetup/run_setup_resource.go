@@ -1,38 +1,32 @@
 package runsetup
 
 import (
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"context"
+	"time"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/numtide/terraform-provider-linuxbox/sshsession"
 	"github.com/pkg/errors"
 )
 
 func Resource() *schema.Resource {
-	return &schema.Resource{
-		Create: resourceCreate,
-		Read:   resourceRead,
-		Update: resourceUpdate,
-		Delete: resourceDelete,
-
-		Schema: map[string]*schema.Schema{
-			"ssh_key": &schema.Schema{
-				Type:      schema.TypeString,
-				Required:  true,
-				Sensitive: true,
-			},
-
-			"ssh_user": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: false,
-				Default:  "root",
-				Optional: true,
-			},
-
-			"host_address": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
-			},
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
+
+		CustomizeDiff: sshsession.CustomizeHostDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
 
+		Schema: sshsession.ConnectionSchema(map[string]*schema.Schema{
 			"setup": &schema.Schema{
 				Type: schema.TypeList,
 				Elem: &schema.Schema{
@@ -51,28 +45,45 @@ func Resource() *schema.Resource {
 				Type:     schema.TypeString,
 				Optional: true,
 			},
-		},
-	}
+		}),
+	})
 }
 
-func resourceCreate(d *schema.ResourceData, m interface{}) error {
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
 	setup := d.Get("setup").([]interface{})
 
 	for _, sl := range setup {
 		line := sl.(string)
-		stdout, stderr, err := sshsession.Run(d, line)
+		_, _, err := ex.Run(ctx, line)
 		if err != nil {
-			return errors.Wrapf(err, "error while executing %q\nSTDOUT:\n%s\nSTDERR:\n%s\n", line, string(stdout), string(stderr))
+			return sshsession.Diagnostics(errors.Wrap(err, "while running setup"))
 		}
 	}
 
 	d.SetId("-")
 
+	if _, checkSet := d.GetOkExists("check"); !checkSet {
+		return diag.Diagnostics{{
+			Severity:      diag.Warning,
+			Summary:       "setup is never re-run",
+			Detail:        "Without check the setup is assumed to stay in place, changes made on the host after the setup won't be detected.",
+			AttributePath: cty.GetAttrPath("check"),
+		}}
+	}
+
 	return nil
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
 	check, checkSet := d.GetOkExists("check")
 
@@ -80,24 +91,35 @@ func resourceRead(d *schema.ResourceData, m interface{}) error {
 		return nil
 	}
 
-	_, _, err := sshsession.Run(d, check.(string))
-	if sshsession.IsExecError(err) {
+	_, _, err = ex.Run(ctx, check.(string))
+
+	// a check terminated by a signal didn't tell us anything about the setup
+	exitStatus, isExecError := sshsession.ExitStatus(err)
+	if isExecError && exitStatus > 0 {
 		d.SetId("")
 		return nil
 	}
 
 	if err != nil {
-		return errors.Wrapf(err, "while running check")
+		return sshsession.Diagnostics(errors.Wrapf(err, "while running check"))
 	}
 
 	return nil
 }
 
-func resourceUpdate(d *schema.ResourceData, m interface{}) error {
-	return errors.New("update is not supported")
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	if sshsession.OnlyConnectionChanged(d, Resource().Schema) {
+		return resourceRead(ctx, d, m)
+	}
+
+	return diag.Errorf("update is not supported")
 }
 
-func resourceDelete(d *schema.ResourceData, m interface{}) error {
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
 	delete, deleteSet := d.GetOkExists("delete")
 
@@ -105,9 +127,9 @@ func resourceDelete(d *schema.ResourceData, m interface{}) error {
 		return nil
 	}
 
-	stdout, stderr, err := sshsession.Run(d, delete.(string))
+	_, _, err = ex.Run(ctx, delete.(string))
 	if err != nil {
-		return errors.Wrapf(err, "error while executing %q\nSTDOUT:\n%s\nSTDERR:\n%s\n", delete, string(stdout), string(stderr))
+		return sshsession.Diagnostics(errors.Wrap(err, "while running delete"))
 	}
 
 	return nil
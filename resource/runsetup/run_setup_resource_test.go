@@ -0,0 +1,77 @@
+package runsetup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession/sshtest"
+)
+
+func TestAccRunSetup(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	marker := srv.Path("marker")
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: sshtest.ProviderFactories(map[string]*schema.Resource{
+			"linuxbox_run_setup": Resource(),
+		}),
+		CheckDestroy: func(*terraform.State) error {
+			_, err := os.Stat(marker)
+			if !os.IsNotExist(err) {
+				return fmt.Errorf("expected %s to be deleted, got %v", marker, err)
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: testConfig(srv),
+				Check:  testCheckMarker(marker, "one\ntwo\n"),
+			},
+			{
+				// a failing check runs the setup again
+				PreConfig: func() {
+					err := os.Remove(marker)
+					if err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: testConfig(srv),
+				Check:  testCheckMarker(marker, "one\ntwo\n"),
+			},
+		},
+	})
+}
+
+func testConfig(srv *sshtest.Server) string {
+	return fmt.Sprintf(`
+resource "linuxbox_run_setup" "test" {
+  %s
+  setup = [
+    "echo one > marker",
+    "echo two >> marker",
+  ]
+  check  = "test -f marker"
+  delete = "rm marker"
+}
+`, srv.Config())
+}
+
+func testCheckMarker(path, content string) resource.TestCheckFunc {
+	return func(*terraform.State) error {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if string(data) != content {
+			return fmt.Errorf("expected content %q of %s, got %q", content, path, data)
+		}
+
+		return nil
+	}
+}
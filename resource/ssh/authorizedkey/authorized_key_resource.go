@@ -7,116 +7,92 @@ import (
 	"time"
 
 	"github.com/alessio/shellescape"
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession"
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/ssh"
 )
 
 func Resource() *schema.Resource {
-	return &schema.Resource{
-		Create: resourceCreate,
-		Read:   resourceRead,
-		Update: resourceUpdate,
-		Delete: resourceDelete,
-
-		Schema: map[string]*schema.Schema{
-			"host_address": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
-			},
-			"ssh_key": &schema.Schema{
-				Type:      schema.TypeString,
-				Required:  true,
-				Sensitive: true,
-			},
-			"ssh_user": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: false,
-				Default:  "root",
-				Optional: true,
-			},
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
+
+		CustomizeDiff: sshsession.CustomizeHostDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: sshsession.ConnectionSchema(map[string]*schema.Schema{
 			"key_to_add": &schema.Schema{
 				Type:     schema.TypeString,
 				ForceNew: true,
 				Required: true,
 			},
-		},
-	}
+		}),
+	})
 }
 
-func resourceCreate(d *schema.ResourceData, m interface{}) error {
-
-	privateKeyBytes := d.Get("ssh_key").(string)
-	sshUser := d.Get("ssh_user").(string)
-
-	signer, err := ssh.ParsePrivateKey([]byte(privateKeyBytes))
-
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
 	if err != nil {
-		return errors.Wrap(err, "while parsing private ssh_key")
+		return sshsession.Diagnostics(err)
 	}
 
-	config := &ssh.ClientConfig{
-		User: sshUser,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	c, err := sshsession.ConnectionFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
 	}
 
-	server := d.Get("host_address").(string)
-
-	addr := fmt.Sprintf("%s:22", server)
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*3)
-	for {
-		c, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
-		if err == nil {
-			c.Close()
-			break
+	// the host is not directly reachable when connecting through a bastion,
+	// and there is nothing to wait for when running locally
+	if c.BastionAddress == "" && !sshsession.IsLocal(c) {
+		addr, err := sshsession.Address(d, m)
+		if err != nil {
+			return sshsession.Diagnostics(err)
 		}
-		time.Sleep(1 * time.Second)
-	}
-	cancel()
 
-	client, err := ssh.Dial("tcp", addr, config)
-	if err != nil {
-		return errors.Wrapf(err, "while ssh dialing %s", server)
+		waitCtx, cancelWait := context.WithTimeout(ctx, time.Minute*3)
+		for {
+			c, err := (&net.Dialer{}).DialContext(waitCtx, "tcp", addr)
+			if err == nil {
+				c.Close()
+				break
+			}
+			if waitCtx.Err() != nil {
+				cancelWait()
+				return sshsession.Diagnostics(errors.Wrapf(err, "while waiting for %s", addr))
+			}
+			time.Sleep(1 * time.Second)
+		}
+		cancelWait()
 	}
 
-	defer client.Close()
-
 	keyToAdd := d.Get("key_to_add").(string)
 
 	script := fmt.Sprintf("([ ! -d ~/.ssh ] && (mkdir ~/.ssh && chmod 700 ~/.ssh)) ; echo %s >> ~/.ssh/authorized_keys && chmod 700 ~/.ssh/authorized_keys", shellescape.Quote(keyToAdd))
 
-	output, err := runInSession(client, script)
+	_, _, err = ex.Run(ctx, script)
 	if err != nil {
-		return errors.Wrapf(err, "while running `%s`: %s", script, string(output))
+		return sshsession.Diagnostics(errors.Wrap(err, "while adding authorized key"))
 	}
 
 	d.SetId("key")
 
-	return resourceRead(d, m)
+	return resourceRead(ctx, d, m)
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	return nil
 }
 
-func resourceUpdate(d *schema.ResourceData, m interface{}) error {
-	return resourceRead(d, m)
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return resourceRead(ctx, d, m)
 }
 
-func resourceDelete(d *schema.ResourceData, m interface{}) error {
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	return nil
 }
-
-func runInSession(c *ssh.Client, command string) ([]byte, error) {
-	session, err := c.NewSession()
-	if err != nil {
-		return nil, errors.Wrap(err, "while open ssh session")
-	}
-	defer session.Close()
-	return session.Output(command)
-}
@@ -1,52 +1,49 @@
 package swap
 
 import (
+	"context"
 	"fmt"
+	"time"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/numtide/terraform-provider-linuxbox/sshsession"
 	"github.com/pkg/errors"
 )
 
 func Resource() *schema.Resource {
-	return &schema.Resource{
-		Create: resourceCreate,
-		Read:   resourceRead,
-		Update: resourceUpdate,
-		Delete: resourceDelete,
-
-		Schema: map[string]*schema.Schema{
-			"host_address": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
-			},
-			"ssh_key": &schema.Schema{
-				Type:      schema.TypeString,
-				Required:  true,
-				Sensitive: true,
-			},
-			"ssh_user": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: false,
-				Default:  "root",
-				Optional: true,
-			},
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
+
+		CustomizeDiff: sshsession.CustomizeHostDiff,
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+		},
+
+		Schema: sshsession.ConnectionSchema(map[string]*schema.Schema{
 			"swap_size": &schema.Schema{
 				Type:     schema.TypeString,
 				ForceNew: true,
 				Required: true,
 			},
-		},
-	}
+		}),
+	})
 }
 
-func resourceCreate(d *schema.ResourceData, m interface{}) error {
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
 	cmd := "swapon -s"
-	stdout, stderr, err := sshsession.Run(d, cmd)
+	stdout, _, err := ex.Run(ctx, cmd)
 	if err != nil {
-		return errors.Wrapf(err, "while running `%s`:\nSTDOUT:\n%s\nSTDERR:\n%s\n", cmd, string(stdout), string(stderr))
+		return sshsession.Diagnostics(errors.Wrap(err, "while listing swaps"))
 	}
 
 	swapSize := d.Get("swap_size").(string)
@@ -57,33 +54,37 @@ func resourceCreate(d *schema.ResourceData, m interface{}) error {
 			"chmod 0600 /swapfile",
 			"mkswap /swapfile",
 			"swapon /swapfile",
-			"echo /swapfile none swap defaults 0 0 >> /etc/fstab",
+			// the entry may be left over from a previous swap
+			"grep -qxF '/swapfile none swap defaults 0 0' /etc/fstab || echo /swapfile none swap defaults 0 0 >> /etc/fstab",
 		}
 
 		for _, cmd := range commands {
-			stdout, stderr, err := sshsession.Run(d, cmd)
+			_, _, err := ex.Run(ctx, cmd)
 			if err != nil {
-				return errors.Wrapf(err, "while running `%s`:\nSTDOUT:\n%s\nSTDERR:\n%s\n", cmd, string(stdout), string(stderr))
+				return sshsession.Diagnostics(errors.Wrap(err, "while creating swap"))
 			}
 		}
 
 	}
 
-	server := d.Get("host_address").(string)
+	c, err := sshsession.ConnectionFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
-	d.SetId(server + ":" + swapSize)
+	d.SetId(c.HostAddress + ":" + swapSize)
 
-	return resourceRead(d, m)
+	return resourceRead(ctx, d, m)
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	return nil
 }
 
-func resourceUpdate(d *schema.ResourceData, m interface{}) error {
-	return resourceRead(d, m)
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return resourceRead(ctx, d, m)
 }
 
-func resourceDelete(d *schema.ResourceData, m interface{}) error {
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	return nil
 }
@@ -0,0 +1,68 @@
+package textfile
+
+import (
+	"bytes"
+	"context"
+	"text/template"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession"
+	"github.com/pkg/errors"
+)
+
+// render renders the Go template text with the vars of the resource d and
+// the facts of its host, e.g. {{ .vars.port }} and {{ .facts.hostname }}.
+func render(ctx context.Context, d *schema.ResourceData, m interface{}, text string) ([]byte, error) {
+	t, err := parseTemplate(text)
+	if err != nil {
+		return nil, &sshsession.AttributeError{Attribute: "template", Err: err}
+	}
+
+	facts, err := sshsession.Facts(ctx, d, m)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"vars": d.Get("vars").(map[string]interface{}),
+		"facts": map[string]interface{}{
+			"hostname":   facts.Hostname,
+			"primary_ip": facts.PrimaryIP,
+			"cpu_count":  facts.CPUCount,
+			"memory_mb":  facts.MemoryMB,
+		},
+	}
+
+	out := new(bytes.Buffer)
+	err = t.Execute(out, data)
+	if err != nil {
+		return nil, &sshsession.AttributeError{Attribute: "template", Err: errors.Wrap(err, "while rendering template")}
+	}
+
+	return out.Bytes(), nil
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	// a typo in a var name is an error, not an empty string
+	t, err := template.New("template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "while parsing template")
+	}
+
+	return t, nil
+}
+
+func validateTemplate(v interface{}, path cty.Path) diag.Diagnostics {
+	_, err := parseTemplate(v.(string))
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       err.Error(),
+			AttributePath: path,
+		}}
+	}
+
+	return nil
+}
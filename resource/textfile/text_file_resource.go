@@ -1,46 +1,40 @@
 package textfile
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
-	"encoding/base64"
 	"encoding/hex"
-	"fmt"
-	"strconv"
-	"strings"
+	"regexp"
+	"time"
 
-	"github.com/alessio/shellescape"
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/numtide/terraform-provider-linuxbox/sshsession"
 	"github.com/pkg/errors"
 )
 
 func Resource() *schema.Resource {
-	return &schema.Resource{
-		Create: resourceUpdateAndCreate,
-		Read:   resourceRead,
-		Update: resourceUpdateAndCreate,
-		Delete: resourceDelete,
-
-		Schema: map[string]*schema.Schema{
-			"ssh_key": {
-				Type:      schema.TypeString,
-				Required:  true,
-				Sensitive: true,
-			},
+	return sshsession.UpgradeConnectionState(&schema.Resource{
+		CreateContext: resourceCreate,
+		ReadContext:   resourceRead,
+		UpdateContext: resourceUpdate,
+		DeleteContext: resourceDelete,
 
-			"ssh_user": {
-				Type:     schema.TypeString,
-				Required: false,
-				Default:  "root",
-				Optional: true,
-			},
+		Importer: sshsession.Importer(importFile),
 
-			"host_address": {
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
-			},
+		CustomizeDiff: customdiff.Sequence(sshsession.CustomizeHostDiff, customizeDiff),
+
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(20 * time.Minute),
+			Read:   schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(20 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
 
+		Schema: sshsession.ConnectionSchema(sshsession.OwnerSchema(sshsession.BackupSchema(map[string]*schema.Schema{
 			"path": {
 				Type:     schema.TypeString,
 				Required: true,
@@ -48,66 +42,112 @@ func Resource() *schema.Resource {
 			},
 
 			"content": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ExactlyOneOf: []string{"content", "template"},
+				DiffSuppressFunc: func(k, old, new string, d *schema.ResourceData) bool {
+					// without stored content, the hash tells if the content has changed
+					return old == "" && !d.Get("store_content").(bool) && d.Get("content_sha256").(string) == contentSha256([]byte(new))
+				},
 			},
 
-			"owner": {
-				Type:     schema.TypeInt,
-				Optional: true,
-				Default:  0,
+			"template": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ExactlyOneOf:     []string{"content", "template"},
+				ValidateDiagFunc: validateTemplate,
 			},
 
-			"group": {
-				Type:     schema.TypeInt,
+			"vars": {
+				Type: schema.TypeMap,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
 				Optional: true,
-				Default:  0,
 			},
 
-			"mode": {
+			"validate_command": {
 				Type:     schema.TypeString,
 				Optional: true,
-				Default:  "755",
+				ValidateDiagFunc: validation.ToDiagFunc(
+					validation.StringMatch(regexp.MustCompile(`%s`), "must contain %s, the path of the file to validate"),
+				),
 			},
 
-			"sudo": {
+			"store_content": {
 				Type:     schema.TypeBool,
 				Optional: true,
-				Default:  false,
+				Default:  true,
 			},
-		},
-	}
+
+			"content_sha256": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+
+			"mode": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "755",
+				ValidateDiagFunc: validation.ToDiagFunc(
+					validation.StringMatch(regexp.MustCompile(`^[0-7]{3,4}$`), "must be an octal file mode, e.g. 644"),
+				),
+			},
+		}))),
+	})
 }
 
-func resourceUpdateAndCreate(d *schema.ResourceData, m interface{}) error {
+func resourceCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(resourceUpdateAndCreate(ctx, d, m))
+}
+
+func resourceUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	return sshsession.Diagnostics(resourceUpdateAndCreate(ctx, d, m))
+}
+
+func resourceUpdateAndCreate(ctx context.Context, d *schema.ResourceData, m interface{}) error {
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return err
+	}
 
 	content := []byte(d.Get("content").(string))
 
+	if template, ok := d.GetOk("template"); ok {
+		content, err = render(ctx, d, m, template.(string))
+		if err != nil {
+			return err
+		}
+	}
+
 	path := d.Get("path").(string)
 
-	owner := d.Get("owner").(int)
-	group := d.Get("group").(int)
+	owner, group := sshsession.Ownership(d)
 
 	mode := d.Get("mode").(string)
 
-	cmd := fmt.Sprintf(
-		"echo '%s' | base64 -d | cat > %s && chown %d:%d %s && chmod %s %s",
-		base64.StdEncoding.EncodeToString(content),
-		shellescape.Quote(path),
-		owner,
-		group,
-		shellescape.Quote(path),
-		shellescape.Quote(mode),
-		shellescape.Quote(path),
-	)
-
-	if d.Get("sudo").(bool) {
-		cmd = fmt.Sprintf("sudo sh -c %s", shellescape.Quote(cmd))
+	err = sshsession.BackupFile(ctx, ex, d, path)
+	if err != nil {
+		return err
 	}
 
-	stdout, stderr, err := sshsession.Run(d, cmd)
+	err = sshsession.WriteFile(ctx, ex, path, bytes.NewReader(content), sshsession.WriteFileOptions{
+		Owner:           owner,
+		Group:           group,
+		Mode:            mode,
+		ValidateCommand: d.Get("validate_command").(string),
+	})
 	if err != nil {
-		return errors.Wrapf(err, "error while creating file %q:\nSTDOUT:\n%s\nSTDERR:\n%s\n", path, string(stdout), string(stderr))
+		return errors.Wrapf(err, "while creating file %q", path)
+	}
+
+	d.Set("content_sha256", contentSha256(content))
+
+	if _, ok := d.GetOk("template"); ok {
+		d.Set("content", string(content))
+	} else if !d.Get("store_content").(bool) {
+		d.Set("content", "")
 	}
 
 	sh := sha256.New()
@@ -120,79 +160,111 @@ func resourceUpdateAndCreate(d *schema.ResourceData, m interface{}) error {
 	return nil
 }
 
-func resourceRead(d *schema.ResourceData, m interface{}) error {
+func resourceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	path := d.Get("path").(string)
 
-	{
-		cmd := fmt.Sprintf("stat -c '%%u %%g %%a' %s", shellescape.Quote(path))
-
-		if d.Get("sudo").(bool) {
-			cmd = fmt.Sprintf("sudo sh -c %s", shellescape.Quote(cmd))
-		}
-
-		stdout, _, err := sshsession.Run(d, cmd)
-		if err != nil {
-			d.SetId("")
-			return nil
-		}
+	info, err := sshsession.Stat(ctx, d, m, path)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
-		stdoutString := string(stdout)
+	if info == nil {
+		// the path does not exist anymore
+		d.SetId("")
+		return nil
+	}
 
-		stdoutString = strings.TrimSuffix(stdoutString, "\n")
+	sshsession.SetOwnership(d, info)
+	d.Set("mode", info.Mode)
 
-		parts := strings.Split(stdoutString, " ")
-		if len(parts) != 3 {
-			return errors.Errorf("malformed output of %q: %q", cmd, stdoutString)
-		}
+	// the content is only downloaded when it has changed
+	remoteSum, err := sshsession.Sha256(ctx, d, m, path)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
-		owner, err := strconv.Atoi(parts[0])
+	if template, ok := d.GetOk("template"); ok {
+		// the content is what the template renders to with the current
+		// facts, customizeDiff plans an update when the file differs
+		content, err := render(ctx, d, m, template.(string))
 		if err != nil {
-			return errors.Wrapf(err, "while parsing owner id %q", parts[0])
+			return sshsession.Diagnostics(err)
 		}
 
-		d.Set("owner", owner)
+		d.Set("content", string(content))
+		d.Set("content_sha256", remoteSum)
+		return nil
+	}
 
-		group, err := strconv.Atoi(parts[1])
-		if err != nil {
-			return errors.Wrapf(err, "while parsing group id %q", parts[1])
-		}
+	if remoteSum == d.Get("content_sha256").(string) {
+		return nil
+	}
 
-		d.Set("group", group)
+	d.Set("content_sha256", remoteSum)
 
-		d.Set("mode", parts[2])
+	if !d.Get("store_content").(bool) {
+		// the changed hash is enough to plan an update
+		return nil
 	}
 
-	{
+	ex, err := sshsession.ExecutorFor(d, m)
+	if err != nil {
+		return sshsession.Diagnostics(err)
+	}
 
-		cmd := fmt.Sprintf("cat %s", shellescape.Quote(path))
-		stdout, _, err := sshsession.Run(d, cmd)
-		if err != nil {
-			return errors.Wrapf(err, "while getting content of %s", path)
-		}
+	content := new(bytes.Buffer)
+	err = ex.Download(ctx, path, content)
+	if err != nil {
+		return sshsession.Diagnostics(errors.Wrapf(err, "while getting content of %s", path))
+	}
 
-		stdoutString := string(stdout)
+	d.Set("content", content.String())
 
-		d.Set("content", stdoutString)
+	return nil
+}
 
+// customizeDiff plans the hash of changed content. Templates are rendered
+// on apply, as the facts of the host are not known before.
+func customizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if _, ok := d.GetOk("template"); ok || !d.NewValueKnown("template") {
+		drifted := contentSha256([]byte(d.Get("content").(string))) != d.Get("content_sha256").(string)
+		if d.HasChange("template") || d.HasChange("vars") || !d.NewValueKnown("vars") || drifted {
+			err := d.SetNewComputed("content")
+			if err != nil {
+				return err
+			}
+			return d.SetNewComputed("content_sha256")
+		}
+		return nil
 	}
 
+	if d.HasChange("content") {
+		return d.SetNew("content_sha256", contentSha256([]byte(d.Get("content").(string))))
+	}
 	return nil
-
 }
 
-func resourceDelete(d *schema.ResourceData, m interface{}) error {
-	path := d.Get("path").(string)
-
-	cmd := fmt.Sprintf("rm -f %s", shellescape.Quote(path))
+func contentSha256(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
 
-	if d.Get("sudo").(bool) {
-		cmd = fmt.Sprintf("sudo sh -c %s", shellescape.Quote(cmd))
-	}
+func importFile(ctx context.Context, d *schema.ResourceData, m interface{}, path string) error {
+	sum := sha256.Sum256([]byte(path))
+	d.SetId(hex.EncodeToString(sum[:]))
+	d.Set("path", path)
+	d.Set("store_content", true)
+	sshsession.ImportBackup(d)
+	return nil
+}
 
-	stdout, stderr, err := sshsession.Run(d, cmd)
+func resourceDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	ex, err := sshsession.ExecutorFor(d, m)
 	if err != nil {
-		return errors.Wrapf(err, "error while deleting file %s:\nSTDOUT:\n%s\nSTDERR:\n%s\n", path, string(stdout), string(stderr))
+		return sshsession.Diagnostics(err)
 	}
 
-	return nil
+	path := d.Get("path").(string)
+
+	return sshsession.Diagnostics(sshsession.DeleteFile(ctx, ex, d, path))
 }
@@ -0,0 +1,283 @@
+package textfile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession/sshtest"
+)
+
+func TestAccTextFile(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	path := srv.Path("test.txt")
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: sshtest.ProviderFactories(map[string]*schema.Resource{
+			"linuxbox_text_file": Resource(),
+		}),
+		CheckDestroy: testCheckNoFile(path),
+		Steps: []resource.TestStep{
+			{
+				Config: testConfig(srv, path, "hello", "644"),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckFile(path, "hello", 0644),
+					resource.TestCheckResourceAttr("linuxbox_text_file.test", "host_key_fingerprint", srv.HostKeyFingerprint()),
+				),
+			},
+			{
+				Config: testConfig(srv, path, "hello again", "600"),
+				Check:  testCheckFile(path, "hello again", 0600),
+			},
+			{
+				// the file is changed behind the back of terraform
+				PreConfig: func() {
+					err := ioutil.WriteFile(path, []byte("changed"), 0600)
+					if err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: testConfig(srv, path, "hello again", "600"),
+				Check:  testCheckFile(path, "hello again", 0600),
+			},
+		},
+	})
+}
+
+func TestAccTextFileValidateCommand(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	path := srv.Path("test.conf")
+
+	config := func(content string) string {
+		return fmt.Sprintf(`
+resource "linuxbox_text_file" "test" {
+  %s
+  path             = %q
+  content          = %q
+  owner            = %d
+  group            = %d
+  mode             = "644"
+  validate_command = "grep -q '^valid' %%s"
+}
+`, srv.Config(), path, content, os.Getuid(), os.Getgid())
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: sshtest.ProviderFactories(map[string]*schema.Resource{
+			"linuxbox_text_file": Resource(),
+		}),
+		CheckDestroy: testCheckNoFile(path),
+		Steps: []resource.TestStep{
+			{
+				Config: config("valid"),
+				Check:  testCheckFile(path, "valid", 0644),
+			},
+			{
+				Config:      config("broken"),
+				ExpectError: regexp.MustCompile("validate_command rejected"),
+			},
+			{
+				// the rejected content was never moved into place
+				Config: config("valid"),
+				Check:  testCheckFile(path, "valid", 0644),
+			},
+		},
+	})
+}
+
+func TestAccTextFileWithoutStoredContent(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	path := srv.Path("test.txt")
+
+	config := fmt.Sprintf(`
+resource "linuxbox_text_file" "test" {
+  %s
+  path          = %q
+  content       = "hello"
+  owner         = %d
+  group         = %d
+  mode          = "644"
+  store_content = false
+}
+`, srv.Config(), path, os.Getuid(), os.Getgid())
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: sshtest.ProviderFactories(map[string]*schema.Resource{
+			"linuxbox_text_file": Resource(),
+		}),
+		CheckDestroy: testCheckNoFile(path),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					testCheckFile(path, "hello", 0644),
+					resource.TestCheckResourceAttr("linuxbox_text_file.test", "content", ""),
+					resource.TestCheckResourceAttr("linuxbox_text_file.test", "content_sha256", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"),
+				),
+			},
+			{
+				// the drift is detected by the hash of the file
+				PreConfig: func() {
+					err := ioutil.WriteFile(path, []byte("changed"), 0644)
+					if err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config,
+				Check:  testCheckFile(path, "hello", 0644),
+			},
+		},
+	})
+}
+
+func TestAccTextFileTemplate(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	path := srv.Path("test.txt")
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := func(greeting string) string {
+		return fmt.Sprintf(`
+resource "linuxbox_text_file" "test" {
+  %s
+  path     = %q
+  template = "{{ .vars.greeting }} from {{ .facts.hostname }}"
+  vars     = {
+    greeting = %q
+  }
+  owner    = %d
+  group    = %d
+  mode     = "644"
+}
+`, srv.Config(), path, greeting, os.Getuid(), os.Getgid())
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: sshtest.ProviderFactories(map[string]*schema.Resource{
+			"linuxbox_text_file": Resource(),
+		}),
+		CheckDestroy: testCheckNoFile(path),
+		Steps: []resource.TestStep{
+			{
+				Config: config("hello"),
+				Check: resource.ComposeTestCheckFunc(
+					testCheckFile(path, "hello from "+hostname, 0644),
+					resource.TestCheckResourceAttr("linuxbox_text_file.test", "content", "hello from "+hostname),
+				),
+			},
+			{
+				Config: config("bye"),
+				Check:  testCheckFile(path, "bye from "+hostname, 0644),
+			},
+			{
+				// the rendered content is restored
+				PreConfig: func() {
+					err := ioutil.WriteFile(path, []byte("changed"), 0644)
+					if err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config("bye"),
+				Check:  testCheckFile(path, "bye from "+hostname, 0644),
+			},
+			{
+				Config:      strings.Replace(config("bye"), ".vars.greeting", ".vars.typo", 1),
+				ExpectError: regexp.MustCompile(`map has no entry for key "typo"`),
+			},
+		},
+	})
+}
+
+func TestAccTextFileRestoreOnDestroy(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	path := srv.Path("test.txt")
+
+	err := ioutil.WriteFile(path, []byte("original"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := fmt.Sprintf(`
+resource "linuxbox_text_file" "test" {
+  %s
+  path               = %q
+  content            = "hello"
+  owner              = %d
+  group              = %d
+  mode               = "644"
+  restore_on_destroy = true
+}
+`, srv.Config(), path, os.Getuid(), os.Getgid())
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: sshtest.ProviderFactories(map[string]*schema.Resource{
+			"linuxbox_text_file": Resource(),
+		}),
+		CheckDestroy: testCheckFile(path, "original", 0644),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					testCheckFile(path, "hello", 0644),
+					resource.TestMatchResourceAttr("linuxbox_text_file.test", "backup_path", regexp.MustCompile(`test\.txt\.[0-9]{14}\.bak$`)),
+				),
+			},
+		},
+	})
+}
+
+func testConfig(srv *sshtest.Server, path, content, mode string) string {
+	return fmt.Sprintf(`
+resource "linuxbox_text_file" "test" {
+  %s
+  path    = %q
+  content = %q
+  owner   = %d
+  group   = %d
+  mode    = %q
+}
+`, srv.Config(), path, content, os.Getuid(), os.Getgid(), mode)
+}
+
+func testCheckFile(path, content string, mode os.FileMode) resource.TestCheckFunc {
+	return func(*terraform.State) error {
+		st, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if st.Mode().Perm() != mode {
+			return fmt.Errorf("expected mode %o of %s, got %o", mode, path, st.Mode().Perm())
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if string(data) != content {
+			return fmt.Errorf("expected content %q of %s, got %q", content, path, data)
+		}
+
+		return nil
+	}
+}
+
+func testCheckNoFile(path string) resource.TestCheckFunc {
+	return func(*terraform.State) error {
+		_, err := os.Stat(path)
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("expected %s to be deleted, got %v", path, err)
+		}
+		return nil
+	}
+}
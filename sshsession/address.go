@@ -0,0 +1,43 @@
+package sshsession
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+)
+
+// splitHostPort splits address in the `host`, `host:port`, `[ipv6]:port` or
+// bare IPv6 form into host and port, using defaultPort when address has none.
+func splitHostPort(address string, defaultPort int) (string, int, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		// no port in the address
+		host = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+		return host, defaultPort, nil
+	}
+
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "while parsing port of address %q", address)
+	}
+
+	return host, port, nil
+}
+
+// Address returns the `host:port` address of the SSH daemon of the host.
+func Address(d *schema.ResourceData, m interface{}) (string, error) {
+	c, err := ConnectionFor(d, m)
+	if err != nil {
+		return "", err
+	}
+
+	host, port, err := splitHostPort(c.HostAddress, c.Port)
+	if err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
@@ -0,0 +1,89 @@
+package sshsession
+
+import (
+	"bytes"
+	"net"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// authMethods returns the auth methods for connecting with cp. Signers can be
+// backed by the ssh-agent connection, so the returned cleanup function must
+// only be called once the connection has been established.
+func authMethods(cp clientParams) (methods []ssh.AuthMethod, cleanup func(), err error) {
+	var agentConn net.Conn
+
+	cleanup = func() {
+		if agentConn != nil {
+			agentConn.Close()
+		}
+	}
+
+	defer func() {
+		// cleanup is nil when returning an error, so close the agent directly
+		if err != nil && agentConn != nil {
+			agentConn.Close()
+		}
+	}()
+
+	signers := []ssh.Signer{}
+
+	if cp.privateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(cp.privateKey))
+		if err != nil {
+			return nil, nil, attributeError("ssh_key", errors.Wrap(err, "while parsing private ssh_key"))
+		}
+		signers = append(signers, signer)
+	}
+
+	if cp.agentSocket != "" {
+		agentConn, err = net.Dial("unix", cp.agentSocket)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "while connecting to ssh-agent at %s", cp.agentSocket)
+		}
+
+		agentSigners, err := agent.NewClient(agentConn).Signers()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "while getting keys from ssh-agent")
+		}
+		signers = append(signers, agentSigners...)
+	}
+
+	if cp.certificate != "" {
+		pk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cp.certificate))
+		if err != nil {
+			return nil, nil, attributeError("ssh_certificate", errors.Wrap(err, "while parsing ssh_certificate"))
+		}
+
+		cert, isCert := pk.(*ssh.Certificate)
+		if !isCert {
+			return nil, nil, attributeError("ssh_certificate", errors.New("ssh_certificate is not a SSH certificate"))
+		}
+
+		var certSigner ssh.Signer
+		for _, s := range signers {
+			if bytes.Equal(s.PublicKey().Marshal(), cert.Key.Marshal()) {
+				certSigner, err = ssh.NewCertSigner(cert, s)
+				if err != nil {
+					return nil, nil, errors.Wrap(err, "while creating certificate signer")
+				}
+				break
+			}
+		}
+
+		if certSigner == nil {
+			return nil, nil, attributeError("ssh_certificate", errors.New("neither ssh_key nor ssh-agent hold the private key of ssh_certificate"))
+		}
+
+		// offer the certificate first, servers usually only accept that one
+		signers = append([]ssh.Signer{certSigner}, signers...)
+	}
+
+	if len(signers) == 0 {
+		return nil, nil, attributeError("ssh_key", errors.New("no ssh credentials: either ssh_key or ssh_agent must be set"))
+	}
+
+	return []ssh.AuthMethod{ssh.PublicKeys(signers...)}, cleanup, nil
+}
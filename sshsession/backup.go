@@ -0,0 +1,84 @@
+package sshsession
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+)
+
+// BackupSchema adds the attributes keeping a copy of a file, which existed
+// before the resource was created, to the resource schema s.
+func BackupSchema(s map[string]*schema.Schema) map[string]*schema.Schema {
+
+	s["backup"] = &schema.Schema{
+		Type:     schema.TypeBool,
+		Optional: true,
+		Default:  false,
+	}
+
+	s["restore_on_destroy"] = &schema.Schema{
+		Type:     schema.TypeBool,
+		Optional: true,
+		Default:  false,
+	}
+
+	s["backup_path"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Computed: true,
+	}
+
+	return s
+}
+
+// ImportBackup sets the backup attributes of an imported resource d to their
+// defaults, as no backup is taken of a file which already existed.
+func ImportBackup(d *schema.ResourceData) {
+	d.Set("backup", false)
+	d.Set("restore_on_destroy", false)
+	d.Set("backup_path", "")
+}
+
+// BackupFile copies name to a timestamped file next to it when the resource
+// d is created with backup or restore_on_destroy, and records its path in
+// backup_path. Nothing is copied when name does not exist.
+func BackupFile(ctx context.Context, ex Executor, d *schema.ResourceData, name string) error {
+	if !d.IsNewResource() || !(d.Get("backup").(bool) || d.Get("restore_on_destroy").(bool)) {
+		return nil
+	}
+
+	cmd := fmt.Sprintf(
+		`if [ -e %[1]s ]; then b=%[1]s.$(date +%%Y%%m%%d%%H%%M%%S).bak; cp -p %[1]s "$b"; printf '%%s' "$b"; fi`,
+		shellescape.Quote(name),
+	)
+
+	stdout, _, err := ex.Run(ctx, cmd)
+	if err != nil {
+		return errors.Wrapf(err, "while backing up %s", name)
+	}
+
+	d.Set("backup_path", strings.TrimSpace(string(stdout)))
+
+	return nil
+}
+
+// DeleteFile removes name, or puts its backup back in place when the
+// resource d has restore_on_destroy set.
+func DeleteFile(ctx context.Context, ex Executor, d *schema.ResourceData, name string) error {
+	backup := d.Get("backup_path").(string)
+
+	cmd := fmt.Sprintf("rm -f %s", shellescape.Quote(name))
+	if d.Get("restore_on_destroy").(bool) && backup != "" {
+		cmd = fmt.Sprintf("mv -f %s %s", shellescape.Quote(backup), shellescape.Quote(name))
+	}
+
+	_, _, err := ex.Run(ctx, cmd)
+	if err != nil {
+		return errors.Wrapf(err, "while deleting file %q", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package sshsession
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestBackupFile(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, ConnectionSchema(BackupSchema(map[string]*schema.Schema{})), map[string]interface{}{
+		"connection_type":    "local",
+		"restore_on_destroy": true,
+	})
+	d.MarkNewResource()
+
+	ex, err := ExecutorFor(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config")
+
+	err = os.WriteFile(path, []byte("original"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = BackupFile(context.Background(), ex, d, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backup := d.Get("backup_path").(string)
+	if filepath.Dir(backup) != filepath.Dir(path) {
+		t.Fatalf("expected backup next to %s, got %q", path, backup)
+	}
+
+	err = os.WriteFile(path, []byte("replaced"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = DeleteFile(context.Background(), ex, d, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "original" {
+		t.Errorf("expected the original content to be restored, got %q", data)
+	}
+
+	_, err = os.Stat(backup)
+	if !os.IsNotExist(err) {
+		t.Errorf("expected backup %s to be moved back, got %v", backup, err)
+	}
+}
+
+func TestBackupFileMissing(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, ConnectionSchema(BackupSchema(map[string]*schema.Schema{})), map[string]interface{}{
+		"connection_type":    "local",
+		"restore_on_destroy": true,
+	})
+	d.MarkNewResource()
+
+	ex, err := ExecutorFor(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config")
+
+	err = BackupFile(context.Background(), ex, d, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if backup := d.Get("backup_path").(string); backup != "" {
+		t.Fatalf("expected no backup of a missing file, got %q", backup)
+	}
+
+	err = os.WriteFile(path, []byte("created"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// there was nothing to restore, so the file is deleted
+	err = DeleteFile(context.Background(), ex, d, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(path)
+	if !os.IsNotExist(err) {
+		t.Errorf("expected %s to be deleted, got %v", path, err)
+	}
+}
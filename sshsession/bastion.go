@@ -0,0 +1,46 @@
+package sshsession
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// bastionParams returns the parameters for connecting to the bastion host of
+// cp. Credentials of the target are used unless bastion_key is set, and the
+// host key is checked against the known_hosts of the target unless
+// bastion_host_key is set.
+func (cp clientParams) bastionParams() clientParams {
+	bp := clientParams{
+		privateKey:  cp.bastionKey,
+		agentSocket: cp.agentSocket,
+		user:        cp.bastionUser,
+		hostAddress: cp.bastionAddress,
+		port:        cp.bastionPort,
+		hostKey:     cp.bastionHostKey,
+		knownHosts:  cp.knownHosts,
+	}
+
+	if bp.privateKey == "" {
+		bp.privateKey = cp.privateKey
+		bp.certificate = cp.certificate
+	}
+
+	if bp.user == "" {
+		bp.user = cp.user
+	}
+
+	return bp
+}
+
+// dialThrough opens a SSH connection to addr tunneled through the
+// connection to the bastion host, giving up once ctx is done.
+func dialThrough(ctx context.Context, bastion *sshClient, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := bastion.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while connecting to %s through bastion", addr)
+	}
+
+	return newClientConn(ctx, conn, addr, config)
+}
@@ -0,0 +1,87 @@
+package sshsession
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession/sshtest"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestBastionParams(t *testing.T) {
+	cp := clientParams{
+		privateKey:  "target key",
+		user:        "deploy",
+		hostAddress: "10.0.0.2",
+		port:        22,
+		knownHosts:  "bastion.example.com ssh-ed25519 AAAA",
+
+		bastionAddress: "bastion.example.com",
+		bastionPort:    2222,
+	}
+
+	bp := cp.bastionParams()
+
+	if bp.hostAddress != "bastion.example.com" || bp.port != 2222 || bp.user != "deploy" || bp.privateKey != "target key" {
+		t.Errorf("unexpected bastion parameters %+v", bp)
+	}
+
+	if bp.knownHosts != cp.knownHosts {
+		t.Errorf("expected the known_hosts of the target, got %q", bp.knownHosts)
+	}
+}
+
+func TestBastionHostKeyFingerprint(t *testing.T) {
+	bastion := sshtest.NewServer(t)
+	srv := sshtest.NewServer(t)
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(bastion.HostKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resourceData := func(fingerprint string) *schema.ResourceData {
+		return schema.TestResourceDataRaw(t, ConnectionSchema(map[string]*schema.Schema{}), map[string]interface{}{
+			"ssh_key":                      srv.ClientKey,
+			"ssh_user":                     srv.User,
+			"host_address":                 srv.Host,
+			"ssh_port":                     srv.Port,
+			"host_key":                     srv.HostKey,
+			"bastion_address":              fmt.Sprintf("%s:%d", bastion.Host, bastion.Port),
+			"bastion_user":                 bastion.User,
+			"bastion_key":                  bastion.ClientKey,
+			"bastion_host_key_fingerprint": fingerprint,
+		})
+	}
+
+	d := resourceData("")
+
+	ex, err := ExecutorFor(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = ex.Run(context.Background(), "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Get("bastion_host_key_fingerprint") != ssh.FingerprintSHA256(key) {
+		t.Errorf("expected the fingerprint of the bastion to be recorded, got %q", d.Get("bastion_host_key_fingerprint"))
+	}
+
+	ex, err = ExecutorFor(resourceData("SHA256:other"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = ex.Run(context.Background(), "true")
+
+	var ae *AttributeError
+	if !errors.As(err, &ae) || ae.Attribute != "bastion_host_key_fingerprint" {
+		t.Errorf("expected a changed bastion host key to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package sshsession
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+)
+
+// BatchWindow is how long requests are collected before a batch is run.
+// Terraform refreshes resources concurrently, so a short window is enough
+// to catch the reads of all resources being refreshed at the same time.
+var BatchWindow = 10 * time.Millisecond
+
+// BatchSize is the maximal number of requests in a batch, which keeps the
+// command line of a batch short.
+var BatchSize = 100
+
+// BatchFunc runs the requests args in a single remote invocation and returns
+// the result of each request, in the order of args.
+type BatchFunc func(ctx context.Context, ex Executor, args []string) ([][]byte, error)
+
+type batchKey struct {
+	conn Connection
+	kind string
+}
+
+type batch struct {
+	args    []string
+	waiters int
+	full    chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	done    chan struct{}
+	results [][]byte
+	err     error
+}
+
+var (
+	batchesMu sync.Mutex
+	batches   = map[batchKey]*batch{}
+)
+
+// Batch returns the result of fn for arg. Concurrent calls of the same kind
+// for the same host are coalesced into a single call of fn, which is run
+// with the Executor of the resource making the first request.
+func Batch(ctx context.Context, d *schema.ResourceData, m interface{}, kind, arg string, fn BatchFunc) ([]byte, error) {
+	c, err := ConnectionFor(d, m)
+	if err != nil {
+		return nil, err
+	}
+
+	key := batchKey{conn: *c, kind: kind}
+
+	batchesMu.Lock()
+	b := batches[key]
+	if b == nil {
+		ex, err := ExecutorFor(d, m)
+		if err != nil {
+			batchesMu.Unlock()
+			return nil, err
+		}
+
+		b = newBatch(ctx)
+		batches[key] = b
+		go b.run(key, ex, fn)
+	}
+
+	i := len(b.args)
+	b.args = append(b.args, arg)
+	b.waiters++
+
+	if len(b.args) >= BatchSize {
+		// later requests go into a new batch
+		delete(batches, key)
+		close(b.full)
+	}
+	batchesMu.Unlock()
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		batchesMu.Lock()
+		b.waiters--
+		if b.waiters == 0 {
+			// nobody is interested in the result anymore
+			if batches[key] == b {
+				delete(batches, key)
+			}
+			b.cancel()
+		}
+		batchesMu.Unlock()
+		return nil, ctx.Err()
+	}
+
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	// the batch ran on the connection of another resource, so the host key
+	// must still be checked against the fingerprint recorded for d
+	if !IsLocal(c) {
+		_, err = getClient(ctx, d, c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return b.results[i], nil
+}
+
+func newBatch(ctx context.Context) *batch {
+	// the batch serves all waiters, it is only cancelled once none is left
+	batchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	return &batch{
+		full:   make(chan struct{}),
+		ctx:    batchCtx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+func (b *batch) run(key batchKey, ex Executor, fn BatchFunc) {
+	defer close(b.done)
+	defer b.cancel()
+
+	timer := time.NewTimer(BatchWindow)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-b.full:
+	case <-b.ctx.Done():
+	}
+
+	batchesMu.Lock()
+	if batches[key] == b {
+		delete(batches, key)
+	}
+	args := b.args
+	batchesMu.Unlock()
+
+	tflog.Debug(b.ctx, "running batch", map[string]interface{}{
+		"kind":     key.kind,
+		"requests": len(args),
+	})
+
+	results, err := fn(b.ctx, ex, args)
+	if err == nil && len(results) != len(args) {
+		err = errors.Errorf("%s batch returned %d results for %d requests", key.kind, len(results), len(args))
+	}
+
+	b.results = results
+	b.err = err
+}
+
+// RunBatch runs cmd printing one line for each of the n requests of a batch,
+// "-" for requests without result, and returns the lines as the results of
+// a BatchFunc.
+func RunBatch(ctx context.Context, ex Executor, cmd string, n int) ([][]byte, error) {
+	stdout, _, err := ex.Run(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(stdout, []byte("\n")), []byte("\n"))
+	if len(lines) != n {
+		return nil, errors.Errorf("expected %d lines of output, got %d: %q", n, len(lines), stdout)
+	}
+
+	results := make([][]byte, n)
+	for i, l := range lines {
+		if !bytes.Equal(l, []byte("-")) {
+			results[i] = l
+		}
+	}
+
+	return results, nil
+}
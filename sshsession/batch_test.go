@@ -0,0 +1,100 @@
+package sshsession
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/numtide/terraform-provider-linuxbox/sshsession/sshtest"
+)
+
+func TestBatch(t *testing.T) {
+	srv := sshtest.NewServer(t)
+
+	defer func(w time.Duration) { BatchWindow = w }(BatchWindow)
+	BatchWindow = 200 * time.Millisecond
+
+	n := 20
+	for i := 0; i < n; i += 2 {
+		err := os.WriteFile(srv.Path(fmt.Sprintf("file%d", i)), []byte(fmt.Sprintf("content %d", i)), 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	infos := make([]*FileInfo, n)
+	sums := make([]string, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		// every resource has its own ResourceData
+		d := testResourceData(t, srv)
+		path := srv.Path(fmt.Sprintf("file%d", i))
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			infos[i], errs[i] = Stat(context.Background(), d, nil, path)
+			if errs[i] == nil {
+				sums[i], errs[i] = Sha256(context.Background(), d, nil, path)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+
+		if i%2 == 1 {
+			if infos[i] != nil || sums[i] != "" {
+				t.Errorf("expected file%d not to exist, got %+v %q", i, infos[i], sums[i])
+			}
+			continue
+		}
+
+		if infos[i] == nil || infos[i].Mode != "640" || infos[i].Owner != os.Getuid() {
+			t.Errorf("unexpected status of file%d: %+v", i, infos[i])
+		}
+
+		sum := sha256.Sum256([]byte(fmt.Sprintf("content %d", i)))
+		if sums[i] != hex.EncodeToString(sum[:]) {
+			t.Errorf("unexpected hash of file%d: %q", i, sums[i])
+		}
+	}
+
+	// one batch of stat and one of sha256
+	if srv.Sessions() != 2 {
+		t.Errorf("expected 2 sessions, got %d", srv.Sessions())
+	}
+}
+
+func TestBatchCancel(t *testing.T) {
+	srv := sshtest.NewServer(t)
+
+	defer func(w time.Duration) { BatchWindow = w }(BatchWindow)
+	BatchWindow = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := Stat(ctx, testResourceData(t, srv), nil, srv.Path("file"))
+	if err == nil {
+		t.Fatal("expected the cancelled batch to fail")
+	}
+
+	// the abandoned batch must not be joined by later requests
+	BatchWindow = time.Millisecond
+
+	info, err := Stat(context.Background(), testResourceData(t, srv), nil, srv.Path("file"))
+	if err != nil || info != nil {
+		t.Errorf("expected no file, got %+v %v", info, err)
+	}
+}
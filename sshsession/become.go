@@ -0,0 +1,97 @@
+package sshsession
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/pkg/errors"
+)
+
+// become runs commands as another user through sudo or doas.
+type become struct {
+	method   string
+	user     string
+	password string
+}
+
+// newBecome returns the become settings of c, or nil when become is not
+// enabled.
+func newBecome(c *Connection) (*become, error) {
+	if !c.Become {
+		return nil, nil
+	}
+
+	b := &become{
+		method:   c.BecomeMethod,
+		user:     c.BecomeUser,
+		password: c.BecomePassword,
+	}
+
+	if b.method == "" {
+		b.method = "sudo"
+	}
+
+	if b.user == "" {
+		b.user = "root"
+	}
+
+	switch b.method {
+	case "sudo":
+	case "doas":
+		if b.password != "" {
+			// doas only reads passwords from a terminal
+			return nil, attributeError("become_password", errors.New("become_password is not supported with become_method doas"))
+		}
+	default:
+		return nil, attributeError("become_method", errors.Errorf("unsupported become_method %q", b.method))
+	}
+
+	return b, nil
+}
+
+// askpassScript is run by `sudo -A`. It prints the password, which the
+// wrapping shell has read from the first line of stdin, so the password is
+// neither part of a command line nor written to disk.
+const askpassScript = `#!/bin/sh
+printf '%s\n' "$LINUXBOX_BECOME_PASSWORD"
+`
+
+// wrap returns cmd running as the become user and the stdin to feed it.
+func (b *become) wrap(cmd string, stdin io.Reader) (string, io.Reader) {
+	if b == nil {
+		return cmd, stdin
+	}
+
+	if b.method == "doas" {
+		return fmt.Sprintf("doas -n -u %s sh -c %s", shellescape.Quote(b.user), shellescape.Quote(cmd)), stdin
+	}
+
+	if b.password == "" {
+		return fmt.Sprintf("sudo -n -u %s sh -c %s", shellescape.Quote(b.user), shellescape.Quote(cmd)), stdin
+	}
+
+	// the password is only read by the askpass script when sudo asks for it,
+	// the rest of stdin is passed to cmd in either case.
+	wrapped := strings.Join([]string{
+		"IFS= read -r LINUXBOX_BECOME_PASSWORD",
+		"export LINUXBOX_BECOME_PASSWORD",
+		"askpass=$(mktemp)",
+		"trap 'rm -f \"$askpass\"' EXIT",
+		fmt.Sprintf("printf '%%s' %s > \"$askpass\"", shellescape.Quote(askpassScript)),
+		"chmod 700 \"$askpass\"",
+		fmt.Sprintf(
+			"SUDO_ASKPASS=\"$askpass\" sudo -A -u %s sh -c %s",
+			shellescape.Quote(b.user),
+			// sudoers can keep the environment, the password must not reach cmd
+			shellescape.Quote("unset LINUXBOX_BECOME_PASSWORD\n"+cmd),
+		),
+	}, "\n")
+
+	if stdin == nil {
+		stdin = strings.NewReader("")
+	}
+
+	return wrapped, io.MultiReader(strings.NewReader(b.password+"\n"), stdin)
+}
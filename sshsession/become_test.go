@@ -0,0 +1,96 @@
+package sshsession
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// fakeSudo checks the password printed by the askpass program, records the
+// target user and runs the command as the current user.
+const fakeSudo = `#!/bin/sh
+while [ $# -gt 0 ]; do
+  case "$1" in
+    -n) shift ;;
+    -A) [ "$("$SUDO_ASKPASS")" = secret ] || { echo "wrong password" >&2; exit 1; }; shift ;;
+    -u) echo "$2" > "$BECOME_LOG"; shift 2 ;;
+    *) break ;;
+  esac
+done
+exec "$@"
+`
+
+func TestBecome(t *testing.T) {
+	dir := t.TempDir()
+
+	err := ioutil.WriteFile(filepath.Join(dir, "sudo"), []byte(fakeSudo), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := filepath.Join(dir, "become.log")
+
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("BECOME_LOG", log)
+
+	d := schema.TestResourceDataRaw(t, ConnectionSchema(map[string]*schema.Schema{}), map[string]interface{}{
+		"connection_type": "local",
+		"become":          true,
+		"become_user":     "app",
+		"become_password": "secret",
+	})
+
+	ex, err := ExecutorFor(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _, err := ex.RunWithStdin(context.Background(), `cat; echo "[$LINUXBOX_BECOME_PASSWORD]"`, strings.NewReader("data\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(stdout) != "data\n[]\n" {
+		t.Errorf("expected stdin without the password, got %q", stdout)
+	}
+
+	user, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(user) != "app\n" {
+		t.Errorf("expected the command to run as app, got %q", user)
+	}
+
+	d.Set("become_password", "wrong")
+
+	ex, err = ExecutorFor(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = ex.Run(context.Background(), "true")
+	if !IsExecError(err) {
+		t.Errorf("expected the command to fail with a wrong password, got %v", err)
+	}
+}
+
+func TestBecomeDoasPassword(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, ConnectionSchema(map[string]*schema.Schema{}), map[string]interface{}{
+		"connection_type": "local",
+		"become":          true,
+		"become_method":   "doas",
+		"become_password": "secret",
+	})
+
+	_, err := ExecutorFor(d, nil)
+	if err == nil {
+		t.Error("expected an error for become_password with doas")
+	}
+}
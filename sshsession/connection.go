@@ -0,0 +1,310 @@
+package sshsession
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+)
+
+// Connection holds the settings used to reach a host. The provider keeps the
+// defaults of its connection block in a Connection, which is passed to the
+// resources as meta.
+type Connection struct {
+	Type        string
+	HostAddress string
+	PrivateKey  string
+	Certificate string
+	User        string
+	Port        int
+	Agent       bool
+	HostKey     string
+	KnownHosts  string
+
+	BastionAddress string
+	BastionUser    string
+	BastionKey     string
+	BastionHostKey string
+
+	Become         bool
+	BecomeMethod   string
+	BecomeUser     string
+	BecomePassword string
+}
+
+// ProviderSchema returns the schema of the connection block of the provider.
+// The attributes are named like their counterparts in the resources.
+func ProviderSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"connection_type": connectionTypeSchema(),
+				"host_address": {
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"ssh_key": {
+					Type:      schema.TypeString,
+					Optional:  true,
+					Sensitive: true,
+				},
+				"ssh_certificate": {
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"ssh_user": {
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"ssh_port": {
+					Type:     schema.TypeInt,
+					Optional: true,
+				},
+				"ssh_agent": {
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				"host_key": {
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"known_hosts": {
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"bastion_address": {
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"bastion_user": {
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"bastion_key": {
+					Type:      schema.TypeString,
+					Optional:  true,
+					Sensitive: true,
+				},
+				"bastion_host_key": {
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"become": {
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				"become_method": becomeMethodSchema(),
+				"become_user": {
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"become_password": {
+					Type:      schema.TypeString,
+					Optional:  true,
+					Sensitive: true,
+				},
+				"sudo": {
+					Type:       schema.TypeBool,
+					Optional:   true,
+					Deprecated: "use become instead",
+				},
+			},
+		},
+	}
+}
+
+// NewConnection returns the defaults set in the connection block of the
+// provider configuration d.
+func NewConnection(d *schema.ResourceData) *Connection {
+	c := &Connection{}
+
+	blocks := d.Get("connection").([]interface{})
+	if len(blocks) == 0 || blocks[0] == nil {
+		return c
+	}
+
+	b := blocks[0].(map[string]interface{})
+
+	c.Type = b["connection_type"].(string)
+	c.HostAddress = b["host_address"].(string)
+	c.PrivateKey = b["ssh_key"].(string)
+	c.Certificate = b["ssh_certificate"].(string)
+	c.User = b["ssh_user"].(string)
+	c.Port = b["ssh_port"].(int)
+	c.Agent = b["ssh_agent"].(bool)
+	c.HostKey = b["host_key"].(string)
+	c.KnownHosts = b["known_hosts"].(string)
+	c.BastionAddress = b["bastion_address"].(string)
+	c.BastionUser = b["bastion_user"].(string)
+	c.BastionKey = b["bastion_key"].(string)
+	c.BastionHostKey = b["bastion_host_key"].(string)
+	c.Become = b["become"].(bool) || b["sudo"].(bool)
+	c.BecomeMethod = b["become_method"].(string)
+	c.BecomeUser = b["become_user"].(string)
+	c.BecomePassword = b["become_password"].(string)
+
+	return c
+}
+
+// ConnectionFor returns the connection of the resource d: attributes set on
+// the resource override the defaults of the provider passed in m.
+func ConnectionFor(d *schema.ResourceData, m interface{}) (*Connection, error) {
+	c := Connection{}
+	if defaults, ok := m.(*Connection); ok && defaults != nil {
+		c = *defaults
+	}
+
+	setString := func(dst *string, key string) {
+		if v, ok := d.GetOk(key); ok {
+			*dst = v.(string)
+		}
+	}
+
+	setString(&c.Type, "connection_type")
+	setString(&c.HostAddress, "host_address")
+	setString(&c.PrivateKey, "ssh_key")
+	setString(&c.Certificate, "ssh_certificate")
+	setString(&c.User, "ssh_user")
+	setString(&c.HostKey, "host_key")
+	setString(&c.KnownHosts, "known_hosts")
+	setString(&c.BastionAddress, "bastion_address")
+	setString(&c.BastionUser, "bastion_user")
+	setString(&c.BastionKey, "bastion_key")
+	setString(&c.BastionHostKey, "bastion_host_key")
+	setString(&c.BecomeMethod, "become_method")
+	setString(&c.BecomeUser, "become_user")
+	setString(&c.BecomePassword, "become_password")
+
+	if v, ok := d.GetOk("ssh_port"); ok {
+		c.Port = v.(int)
+	}
+
+	setBool := func(dst *bool, key string) {
+		if v, ok := resourceBool(d, key); ok {
+			*dst = v
+		}
+	}
+
+	setBool(&c.Agent, "ssh_agent")
+	setBool(&c.Become, "sudo")
+	setBool(&c.Become, "become")
+
+	if c.HostAddress == "" && c.Type != "local" {
+		return nil, attributeError("host_address", errors.New("host_address must be set on the resource or in the connection block of the provider"))
+	}
+
+	if c.User == "" {
+		c.User = "root"
+	}
+
+	if c.Port == 0 {
+		c.Port = 22
+	}
+
+	return &c, nil
+}
+
+// resourceBool returns the bool attribute key of the resource d, and false
+// when it is not set on the resource, so that the provider default applies.
+func resourceBool(d *schema.ResourceData, key string) (bool, bool) {
+	// the config is not available when refreshing or destroying
+	for _, raw := range []cty.Value{d.GetRawConfig(), d.GetRawState()} {
+		if raw.IsNull() || !raw.IsKnown() || !raw.Type().HasAttribute(key) {
+			continue
+		}
+
+		v := raw.GetAttr(key)
+		if v.IsNull() || !v.IsKnown() {
+			return false, false
+		}
+		return v.True(), true
+	}
+
+	// without raw values, an explicit false can't be told from an unset
+	// attribute
+	v, ok := d.GetOk(key)
+	return ok && v.(bool), ok
+}
+
+// CustomizeHostDiff replaces the resource d when the host it is on changes.
+// host_address records the effective host in the state, so moving the
+// attribute between the resource and the connection block of the provider
+// passed in m is a no-op as long as the host stays the same. A new
+// bastion_address forgets the recorded fingerprint of the bastion.
+func CustomizeHostDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	config := d.GetRawConfig()
+	if config.IsNull() || !config.IsKnown() {
+		return nil
+	}
+
+	if v := config.GetAttr("host_address"); v.IsKnown() && v.IsNull() {
+		defaults, ok := m.(*Connection)
+		if !ok || defaults == nil || defaults.HostAddress == "" {
+			// keep the recorded host
+			return nil
+		}
+
+		err := d.SetNew("host_address", defaults.HostAddress)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the fingerprint recorded for another bastion does not apply
+	if d.HasChange("bastion_address") {
+		err := d.SetNewComputed("bastion_host_key_fingerprint")
+		if err != nil {
+			return err
+		}
+	}
+
+	// states written before the host was recorded have no host_address
+	old, _ := d.GetChange("host_address")
+	if old.(string) != "" && d.HasChange("host_address") {
+		return d.ForceNew("host_address")
+	}
+
+	return nil
+}
+
+// connectionAttributes are the attributes which only tell how to reach the
+// host of a resource and how to run commands on it.
+var connectionAttributes = map[string]bool{
+	"connection_type":              true,
+	"host_address":                 true,
+	"ssh_key":                      true,
+	"ssh_certificate":              true,
+	"ssh_user":                     true,
+	"ssh_port":                     true,
+	"ssh_agent":                    true,
+	"host_key":                     true,
+	"known_hosts":                  true,
+	"host_key_fingerprint":         true,
+	"bastion_address":              true,
+	"bastion_user":                 true,
+	"bastion_key":                  true,
+	"bastion_host_key":             true,
+	"bastion_host_key_fingerprint": true,
+	"become":                       true,
+	"become_method":                true,
+	"become_user":                  true,
+	"become_password":              true,
+	"sudo":                         true,
+}
+
+// OnlyConnectionChanged reports if an update of the resource d with schema s
+// changes nothing but the way its host is reached, e.g. when a key was
+// rotated or the attributes were moved into the provider connection block.
+// Such updates don't need to change anything on the host.
+func OnlyConnectionChanged(d *schema.ResourceData, s map[string]*schema.Schema) bool {
+	for k := range s {
+		if !connectionAttributes[k] && d.HasChange(k) {
+			return false
+		}
+	}
+	return true
+}
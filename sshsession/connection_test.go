@@ -0,0 +1,215 @@
+package sshsession
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestConnectionFor(t *testing.T) {
+	s := ConnectionSchema(map[string]*schema.Schema{})
+
+	defaults := &Connection{
+		HostAddress: "example.com",
+		PrivateKey:  "provider key",
+		User:        "deploy",
+		Port:        2222,
+	}
+
+	d := schema.TestResourceDataRaw(t, s, map[string]interface{}{
+		"ssh_key": "resource key",
+	})
+
+	c, err := ConnectionFor(d, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.HostAddress != "example.com" || c.User != "deploy" || c.Port != 2222 {
+		t.Errorf("expected the defaults of the provider, got %+v", c)
+	}
+
+	if c.PrivateKey != "resource key" {
+		t.Errorf("expected ssh_key of the resource to override the provider, got %q", c.PrivateKey)
+	}
+
+	d = schema.TestResourceDataRaw(t, s, map[string]interface{}{
+		"host_address": "other.example.com",
+	})
+
+	c, err = ConnectionFor(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.User != "root" || c.Port != 22 {
+		t.Errorf("expected root@:22 without provider defaults, got %+v", c)
+	}
+
+	d = schema.TestResourceDataRaw(t, s, map[string]interface{}{})
+
+	_, err = ConnectionFor(d, &Connection{})
+	if err == nil {
+		t.Error("expected an error without host_address")
+	}
+}
+
+func TestCustomizeHostDiff(t *testing.T) {
+	r := &schema.Resource{
+		Schema:        ConnectionSchema(map[string]*schema.Schema{}),
+		CustomizeDiff: CustomizeHostDiff,
+	}
+
+	for name, tc := range map[string]struct {
+		state    string
+		config   string
+		provider string
+
+		expected  string
+		forcedNew bool
+		unchanged bool
+	}{
+		"moved to the provider":   {state: "a", provider: "a", unchanged: true},
+		"moved to the resource":   {state: "a", config: "a", provider: "b", unchanged: true},
+		"changed in the provider": {state: "a", provider: "b", expected: "b", forcedNew: true},
+		"changed in the resource": {state: "a", config: "b", provider: "a", expected: "b", forcedNew: true},
+		"recorded on upgrade":     {provider: "a", expected: "a"},
+		"provider without a host": {state: "a", unchanged: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			raw := map[string]interface{}{}
+			config := map[string]cty.Value{}
+			if tc.config != "" {
+				raw["host_address"] = tc.config
+				config["host_address"] = cty.StringVal(tc.config)
+			}
+
+			s := &terraform.InstanceState{
+				ID:         "id",
+				Attributes: map[string]string{"id": "id", "host_address": tc.state},
+				RawConfig:  objectVal(r, config),
+			}
+
+			diff, err := r.SimpleDiff(context.Background(), s, terraform.NewResourceConfigRaw(raw), &Connection{HostAddress: tc.provider})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			attr := diff.Attributes["host_address"]
+			if tc.unchanged {
+				if attr != nil && attr.Old != attr.New {
+					t.Errorf("expected no change, got %+v", attr)
+				}
+				return
+			}
+
+			if attr == nil || attr.New != tc.expected || attr.RequiresNew != tc.forcedNew {
+				t.Errorf("expected host_address %q with RequiresNew %v, got %+v", tc.expected, tc.forcedNew, attr)
+			}
+		})
+	}
+}
+
+// objectVal returns the raw config of resource r with the attributes in
+// values set, and all others null.
+func objectVal(r *schema.Resource, values map[string]cty.Value) cty.Value {
+	attrs := map[string]cty.Value{}
+	for k, ty := range r.CoreConfigSchema().ImpliedType().AttributeTypes() {
+		attrs[k] = cty.NullVal(ty)
+		if v, ok := values[k]; ok {
+			attrs[k] = v
+		}
+	}
+	return cty.ObjectVal(attrs)
+}
+
+func TestConnectionForBool(t *testing.T) {
+	r := &schema.Resource{Schema: ConnectionSchema(map[string]*schema.Schema{})}
+
+	defaults := &Connection{HostAddress: "example.com", Agent: true, Become: true}
+
+	for name, tc := range map[string]struct {
+		values map[string]cty.Value
+		agent  bool
+		become bool
+	}{
+		"unset":           {values: map[string]cty.Value{}, agent: true, become: true},
+		"disabled":        {values: map[string]cty.Value{"ssh_agent": cty.False, "become": cty.False}},
+		"enabled":         {values: map[string]cty.Value{"ssh_agent": cty.True, "become": cty.True}, agent: true, become: true},
+		"sudo overridden": {values: map[string]cty.Value{"sudo": cty.True, "become": cty.False}, agent: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// the state is all there is when refreshing or destroying
+			d := r.Data(&terraform.InstanceState{
+				ID:         "id",
+				Attributes: map[string]string{"id": "id"},
+				RawState:   objectVal(r, tc.values),
+			})
+
+			c, err := ConnectionFor(d, defaults)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c.Agent != tc.agent || c.Become != tc.become {
+				t.Errorf("expected ssh_agent %v and become %v, got %v and %v", tc.agent, tc.become, c.Agent, c.Become)
+			}
+		})
+	}
+}
+
+func TestUpgradeConnectionState(t *testing.T) {
+	r := UpgradeConnectionState(&schema.Resource{Schema: ConnectionSchema(map[string]*schema.Schema{})})
+
+	state, err := r.StateUpgraders[0].Upgrade(context.Background(), map[string]interface{}{
+		"become":    false,
+		"sudo":      false,
+		"ssh_agent": true,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state["become"] != nil || state["sudo"] != nil || state["ssh_agent"] != true {
+		t.Errorf("expected false values to be cleared, got %v", state)
+	}
+}
+
+func TestCustomizeHostDiffBastion(t *testing.T) {
+	r := &schema.Resource{
+		Schema:        ConnectionSchema(map[string]*schema.Schema{}),
+		CustomizeDiff: CustomizeHostDiff,
+	}
+
+	config := map[string]cty.Value{
+		"host_address":    cty.StringVal("a"),
+		"bastion_address": cty.StringVal("new"),
+	}
+
+	s := &terraform.InstanceState{
+		ID: "id",
+		Attributes: map[string]string{
+			"id":                           "id",
+			"host_address":                 "a",
+			"bastion_address":              "old",
+			"bastion_host_key_fingerprint": "SHA256:old",
+		},
+		RawConfig: objectVal(r, config),
+	}
+
+	diff, err := r.SimpleDiff(context.Background(), s, terraform.NewResourceConfigRaw(map[string]interface{}{
+		"host_address":    "a",
+		"bastion_address": "new",
+	}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attr := diff.Attributes["bastion_host_key_fingerprint"]
+	if attr == nil || !attr.NewComputed {
+		t.Errorf("expected the fingerprint of the old bastion to be dropped, got %+v", attr)
+	}
+}
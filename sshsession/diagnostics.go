@@ -0,0 +1,46 @@
+package sshsession
+
+import (
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/pkg/errors"
+)
+
+// AttributeError is an error caused by the value of an attribute, which is
+// either set on the resource or in the connection block of the provider.
+type AttributeError struct {
+	Attribute string
+	Err       error
+}
+
+func (e *AttributeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AttributeError) Unwrap() error {
+	return e.Err
+}
+
+func attributeError(attribute string, err error) error {
+	return &AttributeError{Attribute: attribute, Err: err}
+}
+
+// Diagnostics converts err into diagnostics, pointing at the offending
+// attribute when err is caused by an AttributeError.
+func Diagnostics(err error) diag.Diagnostics {
+	if err == nil {
+		return nil
+	}
+
+	d := diag.Diagnostic{
+		Severity: diag.Error,
+		Summary:  err.Error(),
+	}
+
+	var ae *AttributeError
+	if errors.As(err, &ae) {
+		d.AttributePath = cty.GetAttrPath(ae.Attribute)
+	}
+
+	return diag.Diagnostics{d}
+}
@@ -0,0 +1,42 @@
+package sshsession
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+)
+
+func TestDiagnostics(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, ConnectionSchema(map[string]*schema.Schema{}), map[string]interface{}{
+		"host_address": "example.com",
+		"ssh_key":      "not a key",
+	})
+
+	ex, err := ExecutorFor(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ex.Upload(context.Background(), "/tmp/file", nil)
+
+	diags := Diagnostics(errors.Wrap(err, "while creating file"))
+	if len(diags) != 1 || !diags.HasError() {
+		t.Fatalf("expected one error, got %v", diags)
+	}
+
+	if !diags[0].AttributePath.Equals(cty.GetAttrPath("ssh_key")) {
+		t.Errorf("expected the error to point at ssh_key, got %#v", diags[0].AttributePath)
+	}
+
+	diags = Diagnostics(errors.New("connection refused"))
+	if len(diags) != 1 || diags[0].AttributePath != nil {
+		t.Errorf("expected an error without attribute, got %v", diags)
+	}
+
+	if Diagnostics(nil) != nil {
+		t.Error("expected no diagnostics without error")
+	}
+}
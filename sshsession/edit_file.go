@@ -0,0 +1,131 @@
+package sshsession
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+)
+
+// EditFunc returns the edited content of a file, or content itself when
+// there is nothing to change.
+type EditFunc func(content []byte) ([]byte, error)
+
+type fileLockKey struct {
+	connType string
+	host     string
+	port     int
+	path     string
+}
+
+var (
+	fileLocksMu sync.Mutex
+	fileLocks   = map[fileLockKey]*sync.Mutex{}
+)
+
+// lockFile serialises the edits of the file path on the host of c, as
+// several resources may edit the same file concurrently.
+func lockFile(c *Connection, path string) func() {
+	key := fileLockKey{connType: c.Type, host: c.HostAddress, port: c.Port, path: path}
+
+	fileLocksMu.Lock()
+	l := fileLocks[key]
+	if l == nil {
+		l = &sync.Mutex{}
+		fileLocks[key] = l
+	}
+	fileLocksMu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// ReadFile returns the content of the file name on the host of the resource
+// d, or nil when it does not exist.
+func ReadFile(ctx context.Context, d *schema.ResourceData, m interface{}, name string) ([]byte, error) {
+	info, err := Stat(ctx, d, m, name)
+	if err != nil || info == nil {
+		return nil, err
+	}
+
+	ex, err := ExecutorFor(d, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return download(ctx, ex, name)
+}
+
+// EditFile applies edit to the file name on the host of the resource d, and
+// writes the result back with WriteFile, keeping the owner and mode of the
+// file. A missing file is edited as empty file, it is only written when
+// create is set, and is then owned by the connecting user. Edits of the same
+// file are serialised.
+func EditFile(ctx context.Context, d *schema.ResourceData, m interface{}, name string, create bool, edit EditFunc) error {
+	c, err := ConnectionFor(d, m)
+	if err != nil {
+		return err
+	}
+
+	ex, err := ExecutorFor(d, m)
+	if err != nil {
+		return err
+	}
+
+	defer lockFile(c, name)()
+
+	info, err := Stat(ctx, d, m, name)
+	if err != nil {
+		return err
+	}
+
+	o := WriteFileOptions{Mode: "644"}
+	var content []byte
+
+	if info != nil {
+		o = WriteFileOptions{
+			Owner: strconv.Itoa(info.Owner),
+			Group: strconv.Itoa(info.Group),
+			Mode:  info.Mode,
+		}
+
+		content, err = download(ctx, ex, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	edited, err := edit(content)
+	if err != nil {
+		return err
+	}
+
+	if info == nil {
+		if len(edited) == 0 {
+			// there is nothing to create
+			return nil
+		}
+
+		if !create {
+			return attributeError("path", errors.Errorf("file %s does not exist", name))
+		}
+	} else if bytes.Equal(edited, content) {
+		return nil
+	}
+
+	return WriteFile(ctx, ex, name, bytes.NewReader(edited), o)
+}
+
+func download(ctx context.Context, ex Executor, name string) ([]byte, error) {
+	content := new(bytes.Buffer)
+
+	err := ex.Download(ctx, name, content)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while getting content of %s", name)
+	}
+
+	return content.Bytes(), nil
+}
@@ -0,0 +1,84 @@
+package sshsession
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+)
+
+func TestEditFile(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, ConnectionSchema(map[string]*schema.Schema{}), map[string]interface{}{
+		"connection_type": "local",
+	})
+
+	path := filepath.Join(t.TempDir(), "hosts")
+
+	appendLine := func(line string) EditFunc {
+		return func(content []byte) ([]byte, error) {
+			return append(content, line+"\n"...), nil
+		}
+	}
+
+	err := EditFile(context.Background(), d, nil, path, false, appendLine("first"))
+
+	var ae *AttributeError
+	if !errors.As(err, &ae) || ae.Attribute != "path" {
+		t.Fatalf("expected an error for the missing file, got %v", err)
+	}
+
+	err = EditFile(context.Background(), d, nil, path, true, appendLine("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chmod(path, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent edits must not overwrite each other
+	n := 10
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = EditFile(context.Background(), d, nil, path, false, appendLine(fmt.Sprintf("line %d", i)))
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != n+1 {
+		t.Errorf("expected %d lines, got %q", n+1, data)
+	}
+
+	st, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if st.Mode().Perm() != 0640 {
+		t.Errorf("expected mode 640 to be kept, got %o", st.Mode().Perm())
+	}
+}
@@ -0,0 +1,91 @@
+package sshsession
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+
+	serrors "errors"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ExecError is returned when a remote command has run but did not succeed.
+type ExecError struct {
+	Command string
+
+	// ExitStatus is the exit status of the command, -1 if the command
+	// did not report one.
+	ExitStatus int
+
+	// Signal is the name of the signal that terminated the command, if any.
+	Signal string
+
+	Stdout []byte
+	Stderr []byte
+
+	Err error
+}
+
+func (e *ExecError) Error() string {
+	status := fmt.Sprintf("exit status %d", e.ExitStatus)
+	if e.Signal != "" {
+		status = fmt.Sprintf("signal %s", e.Signal)
+	}
+
+	return fmt.Sprintf("command `%s` failed with %s\nSTDOUT:\n%s\nSTDERR:\n%s\n", e.Command, status, string(e.Stdout), string(e.Stderr))
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// newExecError converts the error of running cmd to *ExecError. Errors not
+// caused by the command itself (e.g. a broken connection) are returned as is.
+// Stdout is set by the Executor, which owns the buffer of the output.
+func newExecError(cmd string, stderr []byte, err error) error {
+	ee := &ExecError{
+		Command: cmd,
+		Stderr:  stderr,
+		Err:     err,
+	}
+
+	var exitErr *ssh.ExitError
+	var exitMissingErr *ssh.ExitMissingError
+	var localExitErr *exec.ExitError
+
+	switch {
+	case serrors.As(err, &exitErr):
+		ee.ExitStatus = exitErr.ExitStatus()
+		ee.Signal = exitErr.Signal()
+	case serrors.As(err, &exitMissingErr):
+		ee.ExitStatus = -1
+	case serrors.As(err, &localExitErr):
+		ee.ExitStatus = localExitErr.ExitCode()
+		if ws, ok := localExitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			ee.Signal = ws.Signal().String()
+		}
+	default:
+		return err
+	}
+
+	return ee
+}
+
+// IsExecError returns true when err was caused by a remote command that did
+// not succeed.
+func IsExecError(err error) bool {
+	var ee *ExecError
+	return serrors.As(err, &ee)
+}
+
+// ExitStatus returns the exit status of the failed remote command causing
+// err. The second return value is false when err was not caused by a
+// remote command.
+func ExitStatus(err error) (int, bool) {
+	var ee *ExecError
+	if !serrors.As(err, &ee) {
+		return 0, false
+	}
+	return ee.ExitStatus, true
+}
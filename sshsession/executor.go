@@ -0,0 +1,199 @@
+package sshsession
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+)
+
+// Executor runs commands and transfers files on the host of a resource.
+type Executor interface {
+	// Run runs cmd and returns its stdout and stderr.
+	Run(ctx context.Context, cmd string) ([]byte, []byte, error)
+
+	// RunWithStdin runs cmd feeding it stdin and returns its stdout and
+	// stderr.
+	RunWithStdin(ctx context.Context, cmd string, stdin io.Reader) ([]byte, []byte, error)
+
+	// Upload streams content into the file at path.
+	Upload(ctx context.Context, path string, content io.Reader) error
+
+	// Download streams the content of the file at path into w.
+	Download(ctx context.Context, path string, w io.Writer) error
+}
+
+// ExecutorFor returns the Executor for the host of the resource, m is the
+// meta of the provider. Commands are run on the machine running Terraform
+// when connection_type is "local", or when it is not set and host_address is
+// "localhost". Otherwise they are run through SSH.
+func ExecutorFor(d *schema.ResourceData, m interface{}) (Executor, error) {
+	c, err := ConnectionFor(d, m)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := newBecome(c)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.Type {
+	case "", "local", "ssh":
+	default:
+		return nil, attributeError("connection_type", errors.Errorf("unsupported connection_type %q", c.Type))
+	}
+
+	run := runLocal
+	if !IsLocal(c) {
+		run = func(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer) ([]byte, error) {
+			return runSSH(ctx, d, c, cmd, stdin, stdout)
+		}
+	}
+
+	host := c.HostAddress
+	if host == "" {
+		host = "localhost"
+	}
+
+	// the become password is passed through stdin, but could be echoed
+	// by a misbehaving command
+	return Redact(&commandExecutor{run: run, become: b, host: host}, c.BecomePassword), nil
+}
+
+// IsLocal reports if the commands of c are run on the machine running
+// Terraform.
+func IsLocal(c *Connection) bool {
+	return c.Type == "local" || (c.Type == "" && c.HostAddress == "localhost")
+}
+
+// runFunc runs cmd streaming its stdout into stdout and returns its stderr.
+type runFunc func(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer) ([]byte, error)
+
+// commandExecutor implements Executor on top of a function running shell
+// commands. All commands are run as the become user, when become is enabled.
+type commandExecutor struct {
+	run    runFunc
+	become *become
+
+	// host is only used for logging
+	host string
+}
+
+func (e *commandExecutor) Run(ctx context.Context, cmd string) ([]byte, []byte, error) {
+	return e.RunWithStdin(ctx, cmd, nil)
+}
+
+func (e *commandExecutor) RunWithStdin(ctx context.Context, cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	stdout := new(bytes.Buffer)
+	stderr, err := e.runAs(ctx, cmd, stdin, stdout)
+	return stdout.Bytes(), stderr, err
+}
+
+// Upload passes content through the stdin of `cat`, so it is not limited by
+// the maximal length of a command line.
+func (e *commandExecutor) Upload(ctx context.Context, path string, content io.Reader) error {
+	cmd := fmt.Sprintf("cat > %s", shellescape.Quote(path))
+
+	_, err := e.runAs(ctx, cmd, content, io.Discard)
+	if err != nil {
+		return errors.Wrapf(err, "while uploading %s", path)
+	}
+
+	return nil
+}
+
+func (e *commandExecutor) Download(ctx context.Context, path string, w io.Writer) error {
+	cmd := fmt.Sprintf("cat %s", shellescape.Quote(path))
+
+	_, err := e.runAs(ctx, cmd, nil, w)
+	if err != nil {
+		return errors.Wrapf(err, "while downloading %s", path)
+	}
+
+	return nil
+}
+
+// runAs runs cmd as the become user. Each command is logged at debug level,
+// the resource type and request ID are already part of the logging context
+// provided by the SDK.
+func (e *commandExecutor) runAs(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer) ([]byte, error) {
+	ctx = tflog.SetField(ctx, "host", e.host)
+	ctx = tflog.SetField(ctx, "command", cmd)
+	if e.become != nil {
+		ctx = tflog.SetField(ctx, "become_user", e.become.user)
+	}
+
+	tflog.Debug(ctx, "running command")
+
+	var in *countingReader
+	if stdin != nil {
+		in = &countingReader{r: stdin}
+		stdin = in
+	}
+	out := &countingWriter{w: stdout}
+
+	start := time.Now()
+
+	wrapped, wrappedStdin := e.become.wrap(cmd, stdin)
+	stderr, err := e.run(ctx, wrapped, wrappedStdin, out)
+
+	// stdout is only kept for the error when it is not streamed elsewhere,
+	// run only sees the counting writer
+	var ee *ExecError
+	if buf, ok := stdout.(*bytes.Buffer); ok && errors.As(err, &ee) {
+		ee.Stdout = buf.Bytes()
+	}
+
+	fields := map[string]interface{}{
+		"duration":     time.Since(start).String(),
+		"stdout_bytes": out.n,
+		"stderr_bytes": len(stderr),
+	}
+
+	if in != nil {
+		fields["stdin_bytes"] = in.n
+	}
+
+	if exitStatus, isExecError := ExitStatus(err); isExecError {
+		fields["exit_status"] = exitStatus
+	} else if err != nil {
+		fields["error"] = err.Error()
+	} else {
+		fields["exit_status"] = 0
+	}
+
+	tflog.Debug(ctx, "finished command", fields)
+
+	return stderr, err
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,123 @@
+package sshsession
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-log/tflogtest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession/sshtest"
+	"github.com/pkg/errors"
+)
+
+func TestRunLogging(t *testing.T) {
+	srv := sshtest.NewServer(t)
+
+	ex, err := ExecutorFor(testResourceData(t, srv), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ex = Redact(ex, "s3cret")
+
+	output := new(bytes.Buffer)
+	ctx := tflogtest.RootLogger(context.Background(), output)
+
+	_, _, err = ex.RunWithStdin(ctx, "cat; echo s3cret", strings.NewReader("hello\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := tflogtest.MultilineJSONDecode(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []string{}
+	var finished map[string]interface{}
+	for _, e := range entries {
+		messages = append(messages, e["@message"].(string))
+		if e["@message"] == "finished command" {
+			finished = e
+		}
+	}
+
+	expected := "running command,opened ssh session,finished command"
+	if strings.Join(messages, ",") != expected {
+		t.Fatalf("expected log messages %s, got %v", expected, messages)
+	}
+
+	if finished["host"] != srv.Host || finished["exit_status"] != float64(0) {
+		t.Errorf("unexpected fields %v", finished)
+	}
+
+	if finished["stdin_bytes"] != float64(6) || finished["stdout_bytes"] != float64(13) {
+		t.Errorf("unexpected byte counts %v", finished)
+	}
+
+	if strings.Contains(finished["command"].(string), "s3cret") {
+		t.Errorf("secret not masked in %q", finished["command"])
+	}
+}
+
+func TestRunLoggingFailure(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, ConnectionSchema(map[string]*schema.Schema{}), map[string]interface{}{
+		"connection_type": "local",
+	})
+
+	ex, err := ExecutorFor(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := new(bytes.Buffer)
+	ctx := tflogtest.RootLogger(context.Background(), output)
+
+	_, _, err = ex.Run(ctx, "exit 4")
+	if err == nil {
+		t.Fatal("expected the command to fail")
+	}
+
+	entries, err := tflogtest.MultilineJSONDecode(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := entries[len(entries)-1]
+	if last["exit_status"] != float64(4) || last["host"] != "localhost" {
+		t.Errorf("unexpected fields %v", last)
+	}
+}
+
+func TestRunExecErrorOutput(t *testing.T) {
+	srv := sshtest.NewServer(t)
+
+	local := schema.TestResourceDataRaw(t, ConnectionSchema(map[string]*schema.Schema{}), map[string]interface{}{
+		"connection_type": "local",
+	})
+
+	for name, d := range map[string]*schema.ResourceData{
+		"local": local,
+		"ssh":   testResourceData(t, srv),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ex, err := ExecutorFor(d, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, err = ex.Run(context.Background(), "echo out; echo err >&2; exit 2")
+
+			var ee *ExecError
+			if !errors.As(err, &ee) {
+				t.Fatalf("expected an ExecError, got %v", err)
+			}
+
+			if string(ee.Stdout) != "out\n" || string(ee.Stderr) != "err\n" || ee.ExitStatus != 2 {
+				t.Errorf("unexpected stdout %q, stderr %q and exit status %d", ee.Stdout, ee.Stderr, ee.ExitStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package sshsession
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+)
+
+// HostFacts describes the host of a resource.
+type HostFacts struct {
+	Hostname string
+
+	// PrimaryIP is the source address of the default route, "" when the
+	// host has none.
+	PrimaryIP string
+
+	CPUCount int
+	MemoryMB int
+}
+
+// factsCmd prints the facts as key=value lines, using only POSIX tools and
+// /proc, so that it works on minimal hosts.
+const factsCmd = `printf 'hostname=%s\n' "$(uname -n)"
+ip=$(ip -4 route get 1.1.1.1 2>/dev/null | sed -n 's/.* src \([^ ]*\).*/\1/p')
+[ -n "$ip" ] || ip=$(hostname -I 2>/dev/null | cut -d ' ' -f 1)
+printf 'primary_ip=%s\n' "$ip"
+printf 'cpu_count=%s\n' "$(getconf _NPROCESSORS_ONLN)"
+printf 'memory_kb=%s\n' "$(sed -n 's/^MemTotal: *\([0-9]*\).*/\1/p' /proc/meminfo)"`
+
+// Facts gathers the HostFacts of the host of the resource d. Concurrent
+// calls for the same host share a single command.
+func Facts(ctx context.Context, d *schema.ResourceData, m interface{}) (*HostFacts, error) {
+	out, err := Batch(ctx, d, m, "facts", "", factsBatch)
+	if err != nil {
+		return nil, errors.Wrap(err, "while gathering host facts")
+	}
+
+	return parseFacts(out)
+}
+
+func factsBatch(ctx context.Context, ex Executor, args []string) ([][]byte, error) {
+	stdout, _, err := ex.Run(ctx, factsCmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// the facts do not depend on the request
+	results := make([][]byte, len(args))
+	for i := range results {
+		results[i] = stdout
+	}
+
+	return results, nil
+}
+
+func parseFacts(out []byte) (*HostFacts, error) {
+	f := &HostFacts{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("malformed host fact %q", scanner.Text())
+		}
+
+		key, value := parts[0], parts[1]
+		if value == "" {
+			// not available on this host
+			continue
+		}
+
+		var err error
+		switch key {
+		case "hostname":
+			f.Hostname = value
+		case "primary_ip":
+			f.PrimaryIP = value
+		case "cpu_count":
+			f.CPUCount, err = strconv.Atoi(value)
+		case "memory_kb":
+			var kb int
+			kb, err = strconv.Atoi(value)
+			f.MemoryMB = kb / 1024
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "while parsing host fact %s", key)
+		}
+	}
+
+	return f, scanner.Err()
+}
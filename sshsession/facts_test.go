@@ -0,0 +1,47 @@
+package sshsession
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/numtide/terraform-provider-linuxbox/sshsession/sshtest"
+)
+
+func TestFacts(t *testing.T) {
+	srv := sshtest.NewServer(t)
+
+	f, err := Facts(context.Background(), testResourceData(t, srv), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Hostname != hostname {
+		t.Errorf("expected hostname %q, got %q", hostname, f.Hostname)
+	}
+
+	if f.PrimaryIP != "" && net.ParseIP(f.PrimaryIP) == nil {
+		t.Errorf("expected primary IP to be an IP address, got %q", f.PrimaryIP)
+	}
+
+	if f.CPUCount < 1 {
+		t.Errorf("expected at least one CPU, got %d", f.CPUCount)
+	}
+
+	if f.MemoryMB < 1 {
+		t.Errorf("expected memory, got %d MB", f.MemoryMB)
+	}
+}
+
+func TestParseFactsMalformed(t *testing.T) {
+	_, err := parseFacts([]byte("hostname=test\ncpu_count=many\n"))
+	if err == nil {
+		t.Fatal("expected error for a non-numeric cpu_count")
+	}
+}
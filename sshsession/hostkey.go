@@ -0,0 +1,102 @@
+package sshsession
+
+import (
+	"net"
+	"os"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// KnownHostsFile is the path of an OpenSSH known_hosts file used to verify
+// host keys of every host. Set from the provider configuration.
+var KnownHostsFile = ""
+
+// hostKeyCallback builds the callback verifying the host key against the
+// pinned host_key or known_hosts entries. When none of those are configured
+// every key is accepted here and the trust-on-first-use check in
+// verifyHostKeyFingerprint is the only protection.
+func hostKeyCallback(cp clientParams) (ssh.HostKeyCallback, error) {
+	if cp.hostKey != "" {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cp.hostKey))
+		if err != nil {
+			return nil, attributeError("host_key", errors.Wrap(err, "while parsing host_key"))
+		}
+		return ssh.FixedHostKey(key), nil
+	}
+
+	files := []string{}
+
+	if KnownHostsFile != "" {
+		files = append(files, KnownHostsFile)
+	}
+
+	if cp.knownHosts != "" {
+		f, err := os.CreateTemp("", "linuxbox-known-hosts")
+		if err != nil {
+			return nil, errors.Wrap(err, "while creating temporary known_hosts file")
+		}
+		defer os.Remove(f.Name())
+
+		_, err = f.WriteString(cp.knownHosts)
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "while writing temporary known_hosts file")
+		}
+
+		err = f.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "while closing temporary known_hosts file")
+		}
+
+		files = append(files, f.Name())
+	}
+
+	if len(files) == 0 {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	cb, err := knownhosts.New(files...)
+	if err != nil {
+		return nil, attributeError("known_hosts", errors.Wrap(err, "while reading known_hosts"))
+	}
+
+	return cb, nil
+}
+
+// recordingHostKeyCallback wraps cb and stores the verified host key in key.
+// Verification failures are stored in keyErr so that dialing can give up
+// instead of retrying.
+func recordingHostKeyCallback(cb ssh.HostKeyCallback, key *ssh.PublicKey, keyErr *error) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, k ssh.PublicKey) error {
+		err := cb(hostname, remote, k)
+		if err != nil {
+			*keyErr = errors.Wrapf(err, "while verifying host key of %s", hostname)
+			return err
+		}
+		*key = k
+		return nil
+	}
+}
+
+// verifyHostKeyFingerprint implements trust on first use: the fingerprint of
+// the host key of address is recorded in the attribute of the state on the
+// first connection and every following connection must present the same key.
+func verifyHostKeyFingerprint(d *schema.ResourceData, attribute, address string, key ssh.PublicKey) error {
+	fingerprint := ssh.FingerprintSHA256(key)
+
+	recorded := d.Get(attribute).(string)
+
+	if recorded != "" && recorded != fingerprint {
+		return attributeError(attribute, errors.Errorf(
+			"host key of %s has changed: expected fingerprint %s, got %s. Someone could be eavesdropping on you (man-in-the-middle attack) or the host has been reinstalled",
+			address,
+			recorded,
+			fingerprint,
+		))
+	}
+
+	return d.Set(attribute, fingerprint)
+}
@@ -0,0 +1,126 @@
+package sshsession
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+)
+
+// ImportFunc sets the attributes identifying object on the imported resource.
+type ImportFunc func(ctx context.Context, d *schema.ResourceData, m interface{}, object string) error
+
+// Importer returns the importer of a resource with import IDs in the
+// `[user@][host[:port]]:object` form, e.g. `deploy@10.0.0.1:2222:/etc/motd`
+// or `[2001:db8::1]:my-network`. Without host, the host_address of the
+// provider connection block is used. Credentials are always taken from the
+// connection block of the provider.
+func Importer(importObject ImportFunc) *schema.ResourceImporter {
+	return &schema.ResourceImporter{
+		StateContext: func(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+			user, address, object, err := ParseImportID(d.Id())
+			if err != nil {
+				return nil, err
+			}
+
+			if user != "" {
+				d.Set("ssh_user", user)
+			}
+
+			defaults, _ := m.(*Connection)
+			if defaults == nil {
+				defaults = &Connection{}
+			}
+
+			defaultPort := defaults.Port
+			if defaultPort == 0 {
+				defaultPort = 22
+			}
+
+			// recording the host the object is on, like CustomizeHostDiff
+			host := defaults.HostAddress
+			if address != "" {
+				var port int
+				host, port, err = splitHostPort(address, defaultPort)
+				if err != nil {
+					return nil, err
+				}
+
+				// keeping ssh_port unset when it is the port used anyway
+				if port != defaultPort {
+					d.Set("ssh_port", port)
+				}
+			}
+			d.Set("host_address", host)
+
+			err = importObject(ctx, d, m, object)
+			if err != nil {
+				return nil, errors.Wrapf(err, "while importing %q", object)
+			}
+
+			return []*schema.ResourceData{d}, nil
+		},
+	}
+}
+
+// ParseImportID splits an import ID in the `[user@][host[:port]]:object`
+// form. IPv6 hosts must be enclosed in brackets. The port is only recognized
+// when it is followed by the object, so `host:1234` is the object `1234` on
+// host.
+func ParseImportID(id string) (user, address, object string, err error) {
+	rest := id
+
+	at := strings.Index(rest, "@")
+	if at >= 0 && at < strings.IndexAny(rest, ":[") {
+		user = rest[:at]
+		rest = rest[at+1:]
+	}
+
+	var host string
+	if strings.HasPrefix(rest, "[") {
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return "", "", "", errors.Errorf("malformed import ID %q: missing ]", id)
+		}
+		host = rest[:end+1]
+		rest = rest[end+1:]
+	} else {
+		colon := strings.Index(rest, ":")
+		if colon < 0 {
+			return "", "", "", errors.Errorf("malformed import ID %q: expected [user@][host[:port]]:object", id)
+		}
+		host = rest[:colon]
+		rest = rest[colon:]
+	}
+
+	if !strings.HasPrefix(rest, ":") {
+		return "", "", "", errors.Errorf("malformed import ID %q: expected : after the host", id)
+	}
+	rest = rest[1:]
+
+	address = host
+	if colon := strings.Index(rest, ":"); host != "" && colon > 0 && isDigits(rest[:colon]) {
+		address = host + ":" + rest[:colon]
+		rest = rest[colon+1:]
+	}
+
+	if rest == "" {
+		return "", "", "", errors.Errorf("malformed import ID %q: missing object", id)
+	}
+
+	if address == "" && user != "" {
+		return "", "", "", errors.Errorf("malformed import ID %q: user without host", id)
+	}
+
+	return user, address, rest, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,82 @@
+package sshsession
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestParseImportID(t *testing.T) {
+	tests := []struct {
+		id      string
+		user    string
+		address string
+		object  string
+	}{
+		{"10.0.0.1:/etc/motd", "", "10.0.0.1", "/etc/motd"},
+		{"deploy@example.com:/etc/motd", "deploy", "example.com", "/etc/motd"},
+		{"example.com:2222:/etc/motd", "", "example.com:2222", "/etc/motd"},
+		{"example.com:/a:b", "", "example.com", "/a:b"},
+		{"example.com:1234", "", "example.com", "1234"},
+		{"example.com:5000:registry:5000", "", "example.com:5000", "registry:5000"},
+		{"[2001:db8::1]:my-network", "", "[2001:db8::1]", "my-network"},
+		{"root@[2001:db8::1]:22:my-network", "root", "[2001:db8::1]:22", "my-network"},
+		{":/etc/motd", "", "", "/etc/motd"},
+		{":2222:/etc/motd", "", "", "2222:/etc/motd"},
+	}
+
+	for _, tt := range tests {
+		user, address, object, err := ParseImportID(tt.id)
+		if err != nil {
+			t.Errorf("%s: %v", tt.id, err)
+			continue
+		}
+
+		if user != tt.user || address != tt.address || object != tt.object {
+			t.Errorf("%s: expected %q %q %q, got %q %q %q", tt.id, tt.user, tt.address, tt.object, user, address, object)
+		}
+	}
+
+	for _, id := range []string{"", "/etc/motd", "example.com:", "[2001:db8::1:foo", "[2001:db8::1]foo", "deploy@:/etc/motd"} {
+		_, _, _, err := ParseImportID(id)
+		if err == nil {
+			t.Errorf("%s: expected an error", id)
+		}
+	}
+}
+
+func TestImporter(t *testing.T) {
+	importer := Importer(func(ctx context.Context, d *schema.ResourceData, m interface{}, object string) error {
+		return nil
+	})
+
+	defaults := &Connection{HostAddress: "default.example.com", Port: 2222}
+
+	tests := []struct {
+		id      string
+		address string
+		port    int
+	}{
+		{":/etc/motd", "default.example.com", 0},
+		{"example.com:2222:/etc/motd", "example.com", 0},
+		{"example.com:/etc/motd", "example.com", 0},
+		{"[2001:db8::1]:2200:/etc/motd", "2001:db8::1", 2200},
+	}
+
+	for _, tt := range tests {
+		d := schema.TestResourceDataRaw(t, ConnectionSchema(map[string]*schema.Schema{}), map[string]interface{}{})
+		d.SetId(tt.id)
+
+		_, err := importer.StateContext(context.Background(), d, defaults)
+		if err != nil {
+			t.Errorf("%s: %v", tt.id, err)
+			continue
+		}
+
+		address, port := d.Get("host_address").(string), d.Get("ssh_port").(int)
+		if address != tt.address || port != tt.port {
+			t.Errorf("%s: expected host_address %q and ssh_port %d, got %q and %d", tt.id, tt.address, tt.port, address, port)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package sshsession
+
+import (
+	"regexp"
+	"strings"
+)
+
+// SplitLines splits the content of a text file into its lines, without the
+// trailing newlines.
+func SplitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+// JoinLines returns the content of a text file made of lines.
+func JoinLines(lines []string) []byte {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// InsertLines inserts insert into lines after the last line matching after,
+// or before the first line matching before, and otherwise at the end. after
+// and before may be nil.
+func InsertLines(lines, insert []string, after, before *regexp.Regexp) []string {
+	at := len(lines)
+	switch {
+	case after != nil:
+		for i := len(lines) - 1; i >= 0; i-- {
+			if after.MatchString(lines[i]) {
+				at = i + 1
+				break
+			}
+		}
+	case before != nil:
+		for i, l := range lines {
+			if before.MatchString(l) {
+				at = i
+				break
+			}
+		}
+	}
+
+	result := make([]string, 0, len(lines)+len(insert))
+	result = append(result, lines[:at]...)
+	result = append(result, insert...)
+	return append(result, lines[at:]...)
+}
@@ -0,0 +1,60 @@
+package sshsession
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSplitLines(t *testing.T) {
+	for content, expected := range map[string][]string{
+		"":         nil,
+		"a\n":      {"a"},
+		"a\nb":     {"a", "b"},
+		"a\n\nb\n": {"a", "", "b"},
+	} {
+		lines := SplitLines([]byte(content))
+		if strings.Join(lines, "|") != strings.Join(expected, "|") || len(lines) != len(expected) {
+			t.Errorf("%q: expected %q, got %q", content, expected, lines)
+		}
+
+		if content != "a\nb" && string(JoinLines(lines)) != content {
+			t.Errorf("%q: joined back to %q", content, JoinLines(lines))
+		}
+	}
+}
+
+func TestInsertLines(t *testing.T) {
+	lines := []string{"# a", "a=1", "# b", "b=1"}
+
+	tests := []struct {
+		after    string
+		before   string
+		expected string
+	}{
+		{"", "", "# a,a=1,# b,b=1,x"},
+		{"^#", "", "# a,a=1,# b,x,b=1"},
+		{"", "^#", "x,# a,a=1,# b,b=1"},
+		{"^c=", "", "# a,a=1,# b,b=1,x"},
+		{"", "^c=", "# a,a=1,# b,b=1,x"},
+	}
+
+	for _, tt := range tests {
+		var after, before *regexp.Regexp
+		if tt.after != "" {
+			after = regexp.MustCompile(tt.after)
+		}
+		if tt.before != "" {
+			before = regexp.MustCompile(tt.before)
+		}
+
+		result := InsertLines(lines, []string{"x"}, after, before)
+		if strings.Join(result, ",") != tt.expected {
+			t.Errorf("after %q, before %q: expected %s, got %s", tt.after, tt.before, tt.expected, strings.Join(result, ","))
+		}
+	}
+
+	if strings.Join(lines, ",") != "# a,a=1,# b,b=1" {
+		t.Errorf("expected lines to be left untouched, got %q", lines)
+	}
+}
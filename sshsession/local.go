@@ -0,0 +1,33 @@
+package sshsession
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// runLocal runs cmd on the machine running Terraform.
+func runLocal(ctx context.Context, cmd string, stdin io.Reader, stdout io.Writer) ([]byte, error) {
+	stderr := new(bytes.Buffer)
+
+	c := exec.CommandContext(ctx, "sh", "-c", cmd)
+	c.Stdin = stdin
+	c.Stdout = stdout
+	c.Stderr = stderr
+
+	err := c.Run()
+
+	if ctx.Err() != nil {
+		return stderr.Bytes(), errors.Wrapf(ctx.Err(), "while running `%s`", cmd)
+	}
+
+	if err != nil {
+		// the stdout of the error is filled in by the executor
+		return stderr.Bytes(), newExecError(cmd, stderr.Bytes(), err)
+	}
+
+	return stderr.Bytes(), nil
+}
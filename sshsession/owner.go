@@ -0,0 +1,74 @@
+package sshsession
+
+import (
+	"strconv"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// OwnerSchema adds the attributes setting the owner and group of a file to
+// the resource schema s. Both can be given as numeric ID (owner, group) or
+// by name (owner_name, group_name), names are resolved on the host.
+func OwnerSchema(s map[string]*schema.Schema) map[string]*schema.Schema {
+
+	s["owner"] = &schema.Schema{
+		Type:          schema.TypeInt,
+		Optional:      true,
+		Default:       0,
+		ConflictsWith: []string{"owner_name"},
+	}
+
+	s["group"] = &schema.Schema{
+		Type:          schema.TypeInt,
+		Optional:      true,
+		Default:       0,
+		ConflictsWith: []string{"group_name"},
+	}
+
+	s["owner_name"] = &schema.Schema{
+		Type:          schema.TypeString,
+		Optional:      true,
+		ConflictsWith: []string{"owner"},
+	}
+
+	s["group_name"] = &schema.Schema{
+		Type:          schema.TypeString,
+		Optional:      true,
+		ConflictsWith: []string{"group"},
+	}
+
+	return s
+}
+
+// Ownership returns the owner and group of the resource d in the form
+// accepted by chown.
+func Ownership(d *schema.ResourceData) (owner string, group string) {
+	owner = d.Get("owner_name").(string)
+	if owner == "" {
+		owner = strconv.Itoa(d.Get("owner").(int))
+	}
+
+	group = d.Get("group_name").(string)
+	if group == "" {
+		group = strconv.Itoa(d.Get("group").(int))
+	}
+
+	return owner, group
+}
+
+// SetOwnership sets the owner and group of the resource d read from the
+// host. Resources owned by name only track the name, so that the numeric
+// IDs may differ between hosts.
+func SetOwnership(d *schema.ResourceData, info *FileInfo) {
+	if d.Get("owner_name").(string) != "" {
+		d.Set("owner_name", info.OwnerName)
+	} else {
+		d.Set("owner", info.Owner)
+	}
+
+	if d.Get("group_name").(string) != "" {
+		d.Set("group_name", info.GroupName)
+	} else {
+		d.Set("group", info.Group)
+	}
+}
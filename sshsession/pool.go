@@ -2,49 +2,125 @@ package sshsession
 
 import (
 	"bytes"
-	"fmt"
+	"context"
 	"io"
+	"net"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	serrors "errors"
 
-	"github.com/hashicorp/terraform-plugin-sdk/helper/schema"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
 )
 
 var SessionLimit = 5
 
+// KeepAliveInterval is the interval of keepalive requests used to detect
+// broken connections, e.g. after a reboot of the host.
+var KeepAliveInterval = 30 * time.Second
+
 type sshClient struct {
 	*ssh.Client
+	hostKey       ssh.PublicKey
+	bastion       *sshClient
+	closed        chan struct{}
 	sessionsInUse int
 	mu            *sync.Mutex
 	cond          *sync.Cond
 }
 
-func newSSHClient(sc *ssh.Client) *sshClient {
+// newSSHClient wraps sc, onClose is called once the connection is closed.
+func newSSHClient(sc *ssh.Client, hostKey ssh.PublicKey, onClose func()) *sshClient {
 	mu := new(sync.Mutex)
-	return &sshClient{
+	s := &sshClient{
 		Client:        sc,
+		hostKey:       hostKey,
+		closed:        make(chan struct{}),
 		sessionsInUse: 0,
 		mu:            mu,
 		cond:          sync.NewCond(mu),
 	}
+
+	go func() {
+		sc.Wait()
+		onClose()
+		close(s.closed)
+	}()
+
+	go s.keepAlive()
+
+	return s
+}
+
+func (s *sshClient) keepAlive() {
+	t := time.NewTicker(KeepAliveInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-t.C:
+			if !s.alive() {
+				s.Client.Close()
+				return
+			}
+		}
+	}
+}
+
+// alive reports if the server replies to a keepalive request in time.
+func (s *sshClient) alive() bool {
+	replied := make(chan error, 1)
+	go func() {
+		_, _, err := s.SendRequest("keepalive@openssh.com", true, nil)
+		replied <- err
+	}()
+
+	select {
+	case err := <-replied:
+		return err == nil
+	case <-time.After(KeepAliveInterval):
+		return false
+	}
 }
 
 type sshSession struct {
 	*ssh.Session
-	cl *sshClient
+	cl   *sshClient
+	once *sync.Once
 }
 
-func (s *sshClient) NewSession() (*sshSession, error) {
+// NewSession opens a new session, waiting for a free slot when SessionLimit
+// sessions are already open.
+func (s *sshClient) NewSession(ctx context.Context) (*sshSession, error) {
+
+	waitDone := make(chan struct{})
+	defer close(waitDone)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		case <-waitDone:
+		}
+	}()
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	for s.sessionsInUse >= SessionLimit {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		s.cond.Wait()
 	}
 
@@ -57,96 +133,170 @@ func (s *sshClient) NewSession() (*sshSession, error) {
 	return &sshSession{
 		Session: cs,
 		cl:      s,
+		once:    new(sync.Once),
 	}, nil
 }
 
+// Close closes the session and frees its slot, it is safe to call it more
+// than once.
 func (s *sshSession) Close() error {
-	defer func() {
-		s.cl.mu.Lock()
-		s.cl.sessionsInUse--
-		s.cl.cond.Broadcast()
-		s.cl.mu.Unlock()
-	}()
-	return s.Session.Close()
+	err := io.EOF
+	s.once.Do(func() {
+		defer func() {
+			s.cl.mu.Lock()
+			s.cl.sessionsInUse--
+			s.cl.cond.Broadcast()
+			s.cl.mu.Unlock()
+		}()
+		err = s.Session.Close()
+	})
+	return err
 }
 
 // ErrTimeout is returned when there was a timeout when connecting to SSH daemon.
 var ErrTimeout = serrors.New("timed out connecting to ssh daemon")
 
 func newClientFuture() *clientFuture {
-	mu := new(sync.Mutex)
 	return &clientFuture{
-		mu:  mu,
-		cnd: sync.NewCond(mu),
+		done: make(chan struct{}),
 	}
 }
 
 type clientFuture struct {
 	client *sshClient
 	err    error
-	mu     *sync.Mutex
-	cnd    *sync.Cond
+	done   chan struct{}
 }
 
-func (cf *clientFuture) getClient() (*sshClient, error) {
-	cf.mu.Lock()
-	defer cf.mu.Unlock()
-	for cf.client == nil && cf.err == nil {
-		cf.cnd.Wait()
+// getClient waits until the client is connected, or ctx is done.
+func (cf *clientFuture) getClient(ctx context.Context) (*sshClient, error) {
+	select {
+	case <-cf.done:
+		return cf.client, cf.err
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "while waiting for ssh connection")
 	}
-	return cf.client, cf.err
 }
 
-func (cf *clientFuture) createClientInternal(cp clientParams) (*sshClient, error) {
-	signer, err := ssh.ParsePrivateKey([]byte(cp.privateKey))
-
+func (cf *clientFuture) createClientInternal(ctx context.Context, cp clientParams) (*sshClient, error) {
+	auth, cleanupAuth, err := authMethods(cp)
 	if err != nil {
-		return nil, errors.Wrap(err, "while parsing private ssh_key")
+		return nil, err
 	}
 
-	server := cp.hostAddress
+	defer cleanupAuth()
+
+	addr := net.JoinHostPort(cp.hostAddress, strconv.Itoa(cp.port))
+
+	verifyHostKey, err := hostKeyCallback(cp)
+	if err != nil {
+		return nil, err
+	}
 
-	addr := fmt.Sprintf("%s:22", server)
+	var hostKey ssh.PublicKey
+	var hostKeyErr error
 
 	config := &ssh.ClientConfig{
-		User: cp.user,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		User:            cp.user,
+		Auth:            auth,
+		HostKeyCallback: recordingHostKeyCallback(verifyHostKey, &hostKey, &hostKeyErr),
 		Timeout:         15 * time.Second,
 	}
 
+	dial := dialDirect
+
+	var bastion *sshClient
+	if cp.bastionAddress != "" {
+		bastion, err = getPooledClient(ctx, cp.bastionParams())
+		if err != nil {
+			return nil, errors.Wrapf(err, "while connecting to bastion %s", cp.bastionAddress)
+		}
+
+		dial = func(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+			return dialThrough(ctx, bastion, addr, config)
+		}
+	}
+
 	var client *ssh.Client
 	deadline := time.Now().Add(time.Minute)
 	for {
-		client, err = ssh.Dial("tcp", addr, config)
+		client, err = dial(ctx, addr, config)
 		if err == nil {
 			break
 		}
 
+		if ctx.Err() != nil {
+			return nil, errors.Wrapf(ctx.Err(), "while connecting to %s", addr)
+		}
+
 		if IsConnectTimeout(err) {
 			return nil, ErrTimeout
 		}
 
+		if hostKeyErr != nil {
+			// retrying won't make the host present a different key
+			return nil, hostKeyErr
+		}
+
 		if time.Now().Before(deadline) {
-			time.Sleep(1 * time.Second)
-			continue
+			select {
+			case <-time.After(1 * time.Second):
+				continue
+			case <-ctx.Done():
+				return nil, errors.Wrapf(ctx.Err(), "while connecting to %s", addr)
+			}
 		}
 
 		return nil, err
 	}
 
-	return newSSHClient(client), nil
+	cl := newSSHClient(client, hostKey, func() { evictClient(cp, cf) })
+	cl.bastion = bastion
+
+	return cl, nil
+
+}
+
+// dialDirect opens a SSH connection to addr, giving up once ctx is done.
+func dialDirect(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := (&net.Dialer{Timeout: config.Timeout}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return newClientConn(ctx, conn, addr, config)
+}
+
+// newClientConn runs the SSH handshake on conn, which is closed when ctx is
+// done before the handshake finished.
+func newClientConn(ctx context.Context, conn net.Conn, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if !stop() {
+		// conn was closed by ctx
+		if err == nil {
+			c.Close()
+		}
+		return nil, ctx.Err()
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
 
+	return ssh.NewClient(c, chans, reqs), nil
 }
 
+// IsConnectTimeout reports if err, or an error it wraps, is a timeout
+// connecting to the SSH daemon.
 func IsConnectTimeout(err error) bool {
 	if err == nil {
 		return false
 	}
 
-	if err == ErrTimeout {
+	if errors.Is(err, ErrTimeout) {
 		return true
 	}
 
@@ -155,102 +305,219 @@ func IsConnectTimeout(err error) bool {
 
 }
 
-func (cf *clientFuture) createClient(cp clientParams) {
-	cl, err := cf.createClientInternal(cp)
-	cf.mu.Lock()
-	cf.client = cl
-	cf.err = err
-	cf.cnd.Broadcast()
-	cf.mu.Unlock()
+func (cf *clientFuture) createClient(ctx context.Context, cp clientParams) {
+	cf.client, cf.err = cf.createClientInternal(ctx, cp)
+	close(cf.done)
 }
 
 type clientParams struct {
 	privateKey  string
+	certificate string
+	agentSocket string
 	user        string
 	hostAddress string
+	port        int
+	hostKey     string
+	knownHosts  string
+
+	bastionAddress string
+	bastionPort    int
+	bastionUser    string
+	bastionKey     string
+	bastionHostKey string
 }
 
 var clientPool = map[clientParams]*clientFuture{}
 var clientPoolMu = new(sync.Mutex)
 
-func getClient(d *schema.ResourceData) (*sshClient, error) {
-	cp := clientParams{
-		privateKey:  d.Get("ssh_key").(string),
-		user:        d.Get("ssh_user").(string),
-		hostAddress: d.Get("host_address").(string),
+func getClient(ctx context.Context, d *schema.ResourceData, c *Connection) (*sshClient, error) {
+	host, port, err := splitHostPort(c.HostAddress, c.Port)
+	if err != nil {
+		return nil, err
 	}
 
-	didCreateFuture := false
-
-	clientPoolMu.Lock()
-	cf := clientPool[cp]
-	if cf == nil {
-		didCreateFuture = true
-		cf = newClientFuture()
-		clientPool[cp] = cf
+	cp := clientParams{
+		privateKey:  c.PrivateKey,
+		certificate: c.Certificate,
+		user:        c.User,
+		hostAddress: host,
+		port:        port,
+		hostKey:     c.HostKey,
+		knownHosts:  c.KnownHosts,
+
+		bastionUser:    c.BastionUser,
+		bastionKey:     c.BastionKey,
+		bastionHostKey: c.BastionHostKey,
 	}
-	clientPoolMu.Unlock()
 
-	if didCreateFuture {
-		cf.createClient(cp)
+	if c.BastionAddress != "" {
+		cp.bastionAddress, cp.bastionPort, err = splitHostPort(c.BastionAddress, 22)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return cf.getClient()
-}
+	if c.Agent {
+		cp.agentSocket = os.Getenv("SSH_AUTH_SOCK")
+		if cp.agentSocket == "" {
+			return nil, errors.New("ssh_agent is enabled but SSH_AUTH_SOCK is not set")
+		}
+	}
 
-func Run(d *schema.ResourceData, cmd string) ([]byte, []byte, error) {
-	cl, err := getClient(d)
+	cl, err := getPooledClient(ctx, cp)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	session, err := cl.NewSession()
+
+	err = verifyHostKeyFingerprint(d, "host_key_fingerprint", c.HostAddress, cl.hostKey)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "while open ssh session")
+		return nil, err
 	}
-	defer session.Close()
 
-	stdout := new(bytes.Buffer)
-	stderr := new(bytes.Buffer)
+	if cl.bastion != nil {
+		err = verifyHostKeyFingerprint(d, "bastion_host_key_fingerprint", c.BastionAddress, cl.bastion.hostKey)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	session.Stdout = stdout
-	session.Stderr = stderr
-	err = session.Run(cmd)
-	return stdout.Bytes(), stderr.Bytes(), err
+	return cl, nil
+}
 
+// getPooledClient returns the client connected with cp, sharing a single
+// connection between all callers using the same parameters. The connection
+// is set up with the ctx of the first caller.
+func getPooledClient(ctx context.Context, cp clientParams) (*sshClient, error) {
+	for {
+		didCreateFuture := false
+
+		clientPoolMu.Lock()
+		cf := clientPool[cp]
+		if cf == nil {
+			didCreateFuture = true
+			cf = newClientFuture()
+			clientPool[cp] = cf
+		}
+		clientPoolMu.Unlock()
+
+		if didCreateFuture {
+			cf.createClient(ctx, cp)
+		}
+
+		cl, err := cf.getClient(ctx)
+		if err != nil {
+			// don't cache the failure, the next caller should try connecting again
+			evictClient(cp, cf)
+
+			if !didCreateFuture && ctx.Err() == nil && isContextError(err) {
+				// the caller setting up the connection gave up, not this one
+				continue
+			}
+
+			return nil, err
+		}
+
+		return cl, nil
+	}
 }
 
-func RunWithStdin(d *schema.ResourceData, cmd string, stdin io.Reader) ([]byte, []byte, error) {
-	cl, err := getClient(d)
-	if err != nil {
-		return nil, nil, err
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// evictClient removes cf from the pool, unless it was already replaced.
+func evictClient(cp clientParams, cf *clientFuture) {
+	clientPoolMu.Lock()
+	if clientPool[cp] == cf {
+		delete(clientPool, cp)
 	}
-	session, err := cl.NewSession()
+	clientPoolMu.Unlock()
+}
+
+// newSession opens a session on the pooled client of the host. When the
+// pooled connection turns out to be broken, it is replaced by a new one.
+func newSession(ctx context.Context, d *schema.ResourceData, c *Connection) (*sshSession, error) {
+	for attempt := 0; ; attempt++ {
+		cl, err := getClient(ctx, d, c)
+		if err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+
+		session, err := cl.NewSession(ctx)
+		if err == nil {
+			tflog.Debug(ctx, "opened ssh session", map[string]interface{}{
+				"session_wait":  time.Since(start).String(),
+				"session_limit": SessionLimit,
+			})
+			return session, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, errors.Wrap(ctx.Err(), "while waiting for ssh session")
+		}
+
+		if attempt == 0 && !cl.alive() {
+			cl.Client.Close()
+			<-cl.closed
+			continue
+		}
+
+		return nil, errors.Wrap(err, "while open ssh session")
+	}
+}
+
+// runSSH runs cmd through a pooled ssh session, streaming its stdout into
+// stdout. It returns the stderr of the command.
+func runSSH(ctx context.Context, d *schema.ResourceData, c *Connection, cmd string, stdin io.Reader, stdout io.Writer) ([]byte, error) {
+	session, err := newSession(ctx, d, c)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "while open ssh session")
+		return nil, err
 	}
 	defer session.Close()
 
-	stdout := new(bytes.Buffer)
 	stderr := new(bytes.Buffer)
 
-	session.Stdin = stdin
+	if stdin != nil {
+		session.Stdin = stdin
+	}
 	session.Stdout = stdout
 	session.Stderr = stderr
-	err = session.Run(cmd)
-	return stdout.Bytes(), stderr.Bytes(), err
 
-}
+	err = session.Start(cmd)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while starting `%s`", cmd)
+	}
 
-func Check(d *schema.ResourceData) error {
-	_, err := getClient(d)
-	return err
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		session.Signal(ssh.SIGTERM)
+		session.Close()
+		// wait for the session to stop writing into stdout and stderr
+		<-done
+		return stderr.Bytes(), errors.Wrapf(ctx.Err(), "while running `%s`", cmd)
+	}
+
+	if err != nil {
+		// the stdout of the error is filled in by the executor
+		return stderr.Bytes(), newExecError(cmd, stderr.Bytes(), err)
+	}
+	return stderr.Bytes(), nil
 }
 
-func IsExecError(err error) bool {
-	if err == nil {
-		return false
+func Check(ctx context.Context, d *schema.ResourceData, m interface{}) error {
+	c, err := ConnectionFor(d, m)
+	if err != nil {
+		return err
 	}
 
-	msg := err.Error()
-	return strings.Contains(msg, "Process exited with status")
+	_, err = getClient(ctx, d, c)
+	return err
 }
@@ -0,0 +1,171 @@
+package sshsession
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/numtide/terraform-provider-linuxbox/sshsession/sshtest"
+	"github.com/pkg/errors"
+)
+
+func testResourceData(t *testing.T, srv *sshtest.Server) *schema.ResourceData {
+	return schema.TestResourceDataRaw(t, ConnectionSchema(map[string]*schema.Schema{}), map[string]interface{}{
+		"ssh_key":      srv.ClientKey,
+		"ssh_user":     srv.User,
+		"host_address": srv.Host,
+		"ssh_port":     srv.Port,
+		"host_key":     srv.HostKey,
+	})
+}
+
+func TestRun(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	d := testResourceData(t, srv)
+
+	ex, err := ExecutorFor(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _, err := ex.Run(context.Background(), "echo hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(stdout) != "hello\n" {
+		t.Errorf("unexpected stdout %q", stdout)
+	}
+
+	_, _, err = ex.Run(context.Background(), "echo oops >&2; exit 3")
+	status, ok := ExitStatus(err)
+	if !ok || status != 3 {
+		t.Fatalf("expected exit status 3, got %v", err)
+	}
+
+	if string(err.(*ExecError).Stderr) != "oops\n" {
+		t.Errorf("unexpected stderr %q", err.(*ExecError).Stderr)
+	}
+}
+
+func TestSessionLimit(t *testing.T) {
+	srv := sshtest.NewServer(t)
+
+	defer func(limit int) { SessionLimit = limit }(SessionLimit)
+	SessionLimit = 2
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		// every resource has its own ResourceData, but they share the client
+		ex, err := ExecutorFor(testResourceData(t, srv), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := ex.Run(context.Background(), "sleep 0.1")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if srv.Sessions() != 10 {
+		t.Errorf("expected 10 sessions, got %d", srv.Sessions())
+	}
+
+	if srv.MaxConcurrentSessions() > SessionLimit {
+		t.Errorf("%d sessions were open at the same time, limit is %d", srv.MaxConcurrentSessions(), SessionLimit)
+	}
+
+	if srv.Connections() != 1 {
+		t.Errorf("expected a single pooled connection, got %d", srv.Connections())
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	srv := sshtest.NewServer(t)
+	d := testResourceData(t, srv)
+
+	ex, err := ExecutorFor(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = ex.Run(context.Background(), "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.CloseConnections()
+
+	_, _, err = ex.Run(context.Background(), "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if srv.Connections() != 2 {
+		t.Errorf("expected the broken connection to be replaced, got %d connections", srv.Connections())
+	}
+}
+
+func TestIsConnectTimeout(t *testing.T) {
+	r := &redactingExecutor{secrets: []string{"s3cret"}}
+
+	err := r.redactError(errors.Wrap(ErrTimeout, "while running command with s3cret"))
+	if !IsConnectTimeout(err) {
+		t.Errorf("expected %v to be a connect timeout", err)
+	}
+
+	if IsConnectTimeout(errors.New("connection refused")) {
+		t.Error("expected other errors not to be connect timeouts")
+	}
+}
+
+func TestConnectCancel(t *testing.T) {
+	srv := sshtest.NewServer(t)
+
+	// a port nothing listens on, so connecting is retried
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().(*net.TCPAddr)
+	l.Close()
+
+	d := schema.TestResourceDataRaw(t, ConnectionSchema(map[string]*schema.Schema{}), map[string]interface{}{
+		"ssh_key":      srv.ClientKey,
+		"host_address": addr.IP.String(),
+		"ssh_port":     addr.Port,
+	})
+
+	ex, err := ExecutorFor(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err = ex.Run(ctx, "true")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to stop connecting, got %v", err)
+	}
+
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("expected connecting to stop with ctx, took %s", time.Since(start))
+	}
+}
@@ -0,0 +1,98 @@
+package sshsession
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// redacted replaces secrets in error messages.
+const redacted = "<redacted>"
+
+// Redact returns ex scrubbing secrets from the errors it returns, including
+// the command line and output of failed commands, and from the logs of the
+// commands. Secrets should be passed
+// to commands through stdin, so they are neither visible in the process list
+// of the host nor part of the command in the first place.
+func Redact(ex Executor, secrets ...string) Executor {
+	r := &redactingExecutor{Executor: ex}
+
+	if parent, ok := ex.(*redactingExecutor); ok {
+		r.Executor = parent.Executor
+		r.secrets = append(r.secrets, parent.secrets...)
+	}
+
+	for _, s := range secrets {
+		if s != "" {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+
+	return r
+}
+
+type redactingExecutor struct {
+	Executor
+	secrets []string
+}
+
+func (r *redactingExecutor) Run(ctx context.Context, cmd string) ([]byte, []byte, error) {
+	stdout, stderr, err := r.Executor.Run(r.mask(ctx), cmd)
+	return stdout, stderr, r.redactError(err)
+}
+
+func (r *redactingExecutor) RunWithStdin(ctx context.Context, cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	stdout, stderr, err := r.Executor.RunWithStdin(r.mask(ctx), cmd, stdin)
+	return stdout, stderr, r.redactError(err)
+}
+
+func (r *redactingExecutor) Upload(ctx context.Context, path string, content io.Reader) error {
+	return r.redactError(r.Executor.Upload(r.mask(ctx), path, content))
+}
+
+func (r *redactingExecutor) Download(ctx context.Context, path string, w io.Writer) error {
+	return r.redactError(r.Executor.Download(r.mask(ctx), path, w))
+}
+
+// mask makes tflog mask the secrets in messages and fields logged with ctx.
+func (r *redactingExecutor) mask(ctx context.Context) context.Context {
+	if len(r.secrets) == 0 {
+		return ctx
+	}
+	return tflog.MaskLogStrings(ctx, r.secrets...)
+}
+
+func (r *redactingExecutor) redact(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+func (r *redactingExecutor) redactError(err error) error {
+	if err == nil || len(r.secrets) == 0 {
+		return err
+	}
+
+	return &redactedError{
+		msg: r.redact(err.Error()),
+		err: err,
+	}
+}
+
+// redactedError keeps the cause of an error for IsExecError and friends, but
+// only shows its scrubbed message.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
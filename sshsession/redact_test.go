@@ -0,0 +1,44 @@
+package sshsession
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestRedact(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, ConnectionSchema(map[string]*schema.Schema{}), map[string]interface{}{
+		"connection_type": "local",
+	})
+
+	ex, err := ExecutorFor(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ex = Redact(ex, "s3cret", "")
+
+	_, _, err = ex.Run(context.Background(), "echo s3cret; echo s3cret >&2; exit 3")
+	if err == nil {
+		t.Fatal("expected the command to fail")
+	}
+
+	if strings.Contains(err.Error(), "s3cret") {
+		t.Errorf("secret not redacted from %q", err)
+	}
+
+	if !strings.Contains(err.Error(), redacted) {
+		t.Errorf("expected %q in %q", redacted, err)
+	}
+
+	if status, ok := ExitStatus(err); !ok || status != 3 {
+		t.Errorf("expected exit status 3, got %d", status)
+	}
+
+	_, _, err = ex.Run(context.Background(), "true")
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package sshsession
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// ConnectionSchema adds the attributes used by sshsession to connect to the
+// host to the resource schema s. All of them are optional, unset attributes
+// are taken from the connection block of the provider.
+func ConnectionSchema(s map[string]*schema.Schema) map[string]*schema.Schema {
+
+	s["connection_type"] = connectionTypeSchema()
+
+	// the state records the host the resource is on, see CustomizeHostDiff
+	s["host_address"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+		Computed: true,
+	}
+
+	s["ssh_key"] = &schema.Schema{
+		Type:      schema.TypeString,
+		Optional:  true,
+		Sensitive: true,
+	}
+
+	s["ssh_user"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+	}
+
+	s["ssh_port"] = &schema.Schema{
+		Type:     schema.TypeInt,
+		Optional: true,
+	}
+
+	s["ssh_agent"] = &schema.Schema{
+		Type:     schema.TypeBool,
+		Optional: true,
+	}
+
+	s["ssh_certificate"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+	}
+
+	s["host_key"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+	}
+
+	s["known_hosts"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+	}
+
+	s["host_key_fingerprint"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+		Computed: true,
+	}
+
+	s["bastion_address"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+	}
+
+	s["bastion_user"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+	}
+
+	s["bastion_key"] = &schema.Schema{
+		Type:      schema.TypeString,
+		Optional:  true,
+		Sensitive: true,
+	}
+
+	s["bastion_host_key"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+	}
+
+	s["bastion_host_key_fingerprint"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+		Computed: true,
+	}
+
+	s["become"] = &schema.Schema{
+		Type:     schema.TypeBool,
+		Optional: true,
+	}
+
+	s["become_method"] = becomeMethodSchema()
+
+	s["become_user"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+	}
+
+	s["become_password"] = &schema.Schema{
+		Type:      schema.TypeString,
+		Optional:  true,
+		Sensitive: true,
+	}
+
+	s["sudo"] = &schema.Schema{
+		Type:       schema.TypeBool,
+		Optional:   true,
+		Deprecated: "use become instead",
+	}
+
+	return s
+}
+
+func connectionTypeSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeString,
+		Optional:     true,
+		ValidateFunc: validation.StringInSlice([]string{"ssh", "local"}, false),
+	}
+}
+
+func becomeMethodSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeString,
+		Optional:     true,
+		ValidateFunc: validation.StringInSlice([]string{"sudo", "doas"}, false),
+	}
+}
+
+// UpgradeConnectionState adds the upgrade of states written before a
+// resource could disable ssh_agent and become to the resource r.
+func UpgradeConnectionState(r *schema.Resource) *schema.Resource {
+	r.SchemaVersion = 1
+	r.StateUpgraders = []schema.StateUpgrader{
+		{
+			Version: 0,
+			Type:    r.CoreConfigSchema().ImpliedType(),
+			Upgrade: upgradeConnectionStateV0,
+		},
+	}
+	return r
+}
+
+// upgradeConnectionStateV0 clears the false values version 0 stored for the
+// unset ssh_agent, become and sudo attributes, as false now overrides the
+// provider.
+func upgradeConnectionStateV0(ctx context.Context, rawState map[string]interface{}, m interface{}) (map[string]interface{}, error) {
+	for _, key := range []string{"ssh_agent", "become", "sudo"} {
+		if v, ok := rawState[key].(bool); ok && !v {
+			rawState[key] = nil
+		}
+	}
+	return rawState, nil
+}
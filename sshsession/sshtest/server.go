@@ -0,0 +1,446 @@
+// Package sshtest provides an in-process ssh server for tests. Commands are
+// run with `sh -c` inside a temporary directory, which also serves as HOME.
+package sshtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"golang.org/x/crypto/ssh"
+)
+
+// Server is an ssh server listening on 127.0.0.1.
+type Server struct {
+	// Host and Port the server is listening on.
+	Host string
+	Port int
+
+	// Dir is the working directory and HOME of all commands.
+	Dir string
+
+	// User is the user name the server expects.
+	User string
+
+	// ClientKey is the PEM encoded private key accepted by the server.
+	ClientKey string
+
+	// HostKey is the host key of the server in authorized_keys format.
+	HostKey string
+
+	listener net.Listener
+	config   *ssh.ServerConfig
+	wg       sync.WaitGroup
+
+	mu             sync.Mutex
+	sessions       int
+	maxSessions    int
+	totalSessions  int
+	closed         bool
+	connections    []*ssh.ServerConn
+	connectionsAll int
+}
+
+// NewServer starts a server, which is stopped when the test finishes.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	hostSigner, _, err := newKey()
+	if err != nil {
+		t.Fatalf("while generating host key: %v", err)
+	}
+
+	clientSigner, clientPEM, err := newKey()
+	if err != nil {
+		t.Fatalf("while generating client key: %v", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("while listening: %v", err)
+	}
+
+	s := &Server{
+		Host:      "127.0.0.1",
+		Port:      l.Addr().(*net.TCPAddr).Port,
+		Dir:       t.TempDir(),
+		User:      "test",
+		ClientKey: clientPEM,
+		HostKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(hostSigner.PublicKey()))),
+		listener:  l,
+	}
+
+	allowed := clientSigner.PublicKey().Marshal()
+
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() != s.User || string(key.Marshal()) != string(allowed) {
+				return nil, fmt.Errorf("unknown public key for %s", meta.User())
+			}
+			return nil, nil
+		},
+	}
+	s.config.AddHostKey(hostSigner)
+
+	s.wg.Add(1)
+	go s.serve()
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func newKey() (ssh.Signer, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	block := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	return signer, string(block), nil
+}
+
+// Close stops the server and closes all connections.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	conns := s.connections
+	s.mu.Unlock()
+
+	s.listener.Close()
+	for _, c := range conns {
+		c.Close()
+	}
+	s.wg.Wait()
+}
+
+// Path returns name relative to the working directory of the server.
+func (s *Server) Path(name string) string {
+	return s.Dir + "/" + name
+}
+
+// Config returns the connection attributes of a resource connecting to the
+// server, to be embedded into the body of the resource block.
+func (s *Server) Config() string {
+	return fmt.Sprintf(`
+  host_address = %q
+  ssh_port     = %d
+  ssh_user     = %q
+  host_key     = %q
+  ssh_key      = <<EOK
+%sEOK
+`, s.Host, s.Port, s.User, s.HostKey, s.ClientKey)
+}
+
+// MaxConcurrentSessions returns the highest number of sessions which were
+// open at the same time.
+func (s *Server) MaxConcurrentSessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxSessions
+}
+
+// Sessions returns the number of sessions opened so far.
+func (s *Server) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.totalSessions
+}
+
+// Connections returns the number of connections accepted so far.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connectionsAll
+}
+
+// CloseConnections drops all open connections, as a rebooting host would.
+func (s *Server) CloseConnections() {
+	s.mu.Lock()
+	conns := s.connections
+	s.connections = nil
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(nc)
+		}()
+	}
+}
+
+func (s *Server) handleConn(nc net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(nc, s.config)
+	if err != nil {
+		nc.Close()
+		return
+	}
+	defer conn.Close()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.connections = append(s.connections, conn)
+	s.connectionsAll++
+	s.mu.Unlock()
+
+	go func() {
+		for req := range reqs {
+			// replies to keepalive@openssh.com and any other global request
+			if req.WantReply {
+				req.Reply(req.Type == "keepalive@openssh.com", nil)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for nch := range chans {
+		if nch.ChannelType() == "direct-tcpip" {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				forward(nch)
+			}()
+			continue
+		}
+
+		if nch.ChannelType() != "session" {
+			nch.Reject(ssh.UnknownChannelType, "only session and direct-tcpip channels are supported")
+			continue
+		}
+
+		ch, chReqs, err := nch.Accept()
+		if err != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handleSession(ch, chReqs)
+		}()
+	}
+}
+
+// forward connects a direct-tcpip channel to its destination, so that the
+// server can serve as bastion.
+func forward(nch ssh.NewChannel) {
+	var dest struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+
+	err := ssh.Unmarshal(nch.ExtraData(), &dest)
+	if err != nil {
+		nch.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(dest.Host, fmt.Sprint(dest.Port)))
+	if err != nil {
+		nch.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer conn.Close()
+
+	ch, reqs, err := nch.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	go ssh.DiscardRequests(reqs)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(conn, ch)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(ch, conn)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func (s *Server) handleSession(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	s.mu.Lock()
+	s.sessions++
+	s.totalSessions++
+	if s.sessions > s.maxSessions {
+		s.maxSessions = s.sessions
+	}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.sessions--
+		s.mu.Unlock()
+	}()
+
+	defer ch.Close()
+
+	var cmd *exec.Cmd
+	exited := make(chan uint32, 1)
+
+	for {
+		select {
+		case status := <-exited:
+			ch.CloseWrite()
+			ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			return
+		case req, ok := <-reqs:
+			if !ok {
+				if cmd != nil && cmd.Process != nil {
+					cmd.Process.Kill()
+				}
+				return
+			}
+
+			switch req.Type {
+			case "exec":
+				if cmd != nil {
+					req.Reply(false, nil)
+					continue
+				}
+
+				var payload struct{ Command string }
+				err := ssh.Unmarshal(req.Payload, &payload)
+				if err != nil {
+					req.Reply(false, nil)
+					continue
+				}
+
+				cmd, err = s.start(ch, payload.Command, exited)
+				req.Reply(err == nil, nil)
+				if err != nil {
+					return
+				}
+			case "signal":
+				if cmd != nil && cmd.Process != nil {
+					cmd.Process.Signal(syscall.SIGTERM)
+				}
+			default:
+				if req.WantReply {
+					req.Reply(req.Type == "env", nil)
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) start(ch ssh.Channel, command string, exited chan<- uint32) (*exec.Cmd, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = s.Dir
+	cmd.Env = append(os.Environ(), "HOME="+s.Dir)
+	cmd.Stdout = ch
+	cmd.Stderr = ch.Stderr()
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		io.Copy(stdin, ch)
+		stdin.Close()
+	}()
+
+	go func() {
+		cmd.Wait()
+		exited <- exitStatus(cmd.ProcessState)
+	}()
+
+	return cmd, nil
+}
+
+func exitStatus(ps *os.ProcessState) uint32 {
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + uint32(ws.Signal())
+	}
+	return uint32(ps.ExitCode())
+}
+
+// ProviderFactories returns the provider factories for resource.TestCase,
+// with a linuxbox provider serving resources.
+func ProviderFactories(resources map[string]*schema.Resource) map[string]func() (*schema.Provider, error) {
+	return map[string]func() (*schema.Provider, error){
+		"linuxbox": func() (*schema.Provider, error) {
+			return &schema.Provider{
+				ResourcesMap: resources,
+			}, nil
+		},
+	}
+}
+
+// HostKeyFingerprint returns the SHA256 fingerprint of the host key.
+func (s *Server) HostKeyFingerprint() string {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s.HostKey))
+	if err != nil {
+		panic(err)
+	}
+	return ssh.FingerprintSHA256(key)
+}
+
+// ProviderConfig returns a provider block with a connection block
+// connecting to the server.
+func (s *Server) ProviderConfig() string {
+	return fmt.Sprintf(`
+provider "linuxbox" {
+  connection {
+    %s
+  }
+}
+`, s.Config())
+}
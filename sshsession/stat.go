@@ -0,0 +1,101 @@
+package sshsession
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+)
+
+// FileInfo holds the ownership and permissions of a file on the host.
+type FileInfo struct {
+	Owner int
+	Group int
+
+	// OwnerName and GroupName are "UNKNOWN" when the IDs have no name.
+	OwnerName string
+	GroupName string
+
+	// Mode are the permissions in octal, e.g. "644".
+	Mode string
+}
+
+// Stat returns the FileInfo of path on the host of the resource d, or nil
+// when path does not exist. Concurrent calls for the same host are batched.
+func Stat(ctx context.Context, d *schema.ResourceData, m interface{}, path string) (*FileInfo, error) {
+	out, err := Batch(ctx, d, m, "stat", path, statBatch)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while getting status of %s", path)
+	}
+
+	if out == nil {
+		return nil, nil
+	}
+
+	parts := strings.Split(string(out), " ")
+	if len(parts) != 5 {
+		return nil, errors.Errorf("malformed status of %s: %q", path, out)
+	}
+
+	owner, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "while parsing owner id %q", parts[0])
+	}
+
+	group, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, errors.Wrapf(err, "while parsing group id %q", parts[1])
+	}
+
+	return &FileInfo{
+		Owner: owner,
+		Group: group,
+		Mode:  parts[2],
+
+		OwnerName: parts[3],
+		GroupName: parts[4],
+	}, nil
+}
+
+// Sha256 returns the hex encoded SHA-256 hash of the content of path on the
+// host of the resource d, or "" when path is not a readable file. Concurrent
+// calls for the same host are batched.
+func Sha256(ctx context.Context, d *schema.ResourceData, m interface{}, path string) (string, error) {
+	out, err := Batch(ctx, d, m, "sha256", path, sha256Batch)
+	if err != nil {
+		return "", errors.Wrapf(err, "while hashing %s", path)
+	}
+
+	return string(out), nil
+}
+
+func statBatch(ctx context.Context, ex Executor, paths []string) ([][]byte, error) {
+	cmd := fmt.Sprintf(
+		`for p in %s; do stat -c '%%u %%g %%a %%U %%G' -- "$p" 2>/dev/null || echo -; done`,
+		quoteAll(paths),
+	)
+
+	return RunBatch(ctx, ex, cmd, len(paths))
+}
+
+func sha256Batch(ctx context.Context, ex Executor, paths []string) ([][]byte, error) {
+	// hashing stdin, as sha256sum escapes unusual file names in its output
+	cmd := fmt.Sprintf(
+		`for p in %s; do if [ -f "$p" ] && [ -r "$p" ]; then sha256sum < "$p" | cut -d ' ' -f 1; else echo -; fi; done`,
+		quoteAll(paths),
+	)
+
+	return RunBatch(ctx, ex, cmd, len(paths))
+}
+
+func quoteAll(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellescape.Quote(a)
+	}
+	return strings.Join(quoted, " ")
+}
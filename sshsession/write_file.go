@@ -0,0 +1,72 @@
+package sshsession
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	"github.com/pkg/errors"
+)
+
+// validationFailed is the exit status of the write script when the
+// validation command rejected the file.
+const validationFailed = 65
+
+// WriteFileOptions are the attributes of a file written by WriteFile.
+type WriteFileOptions struct {
+	// Owner and Group are user and group names or numeric IDs, the file is
+	// owned by the connecting user when both are empty.
+	Owner string
+	Group string
+	Mode  string
+
+	// ValidateCommand is run before the file is moved into place, %s is
+	// replaced by the path of the temporary file.
+	ValidateCommand string
+}
+
+// WriteFile atomically replaces the file name with content: content is
+// written to a temporary file in the same directory, which is only moved to
+// name once its owner and mode are set and ValidateCommand accepted it. On
+// failure, name is left untouched. When name is a symlink, the file it points
+// to is replaced, while a hardlink is broken.
+func WriteFile(ctx context.Context, ex Executor, name string, content io.Reader, o WriteFileOptions) error {
+	lines := []string{
+		"set -e",
+		// a symlink at name is kept, the file it points to is replaced
+		fmt.Sprintf(`target=$(readlink -f %[1]s) || target=%[1]s`, shellescape.Quote(name)),
+		`tmp=$(mktemp "$(dirname "$target")/.$(basename "$target").XXXXXX")`,
+		`trap 'rm -f "$tmp"' EXIT`,
+		`cat > "$tmp"`,
+	}
+
+	if o.Owner != "" || o.Group != "" {
+		lines = append(lines, fmt.Sprintf(`chown %s "$tmp"`, shellescape.Quote(o.Owner+":"+o.Group)))
+	}
+
+	lines = append(lines, fmt.Sprintf(`chmod %s "$tmp"`, shellescape.Quote(o.Mode)))
+
+	if o.ValidateCommand != "" {
+		validate := strings.ReplaceAll(o.ValidateCommand, "%s", `"$tmp"`)
+		lines = append(lines, fmt.Sprintf("if ! ( %s ) >&2; then exit %d; fi", validate, validationFailed))
+	}
+
+	lines = append(lines,
+		`mv -f "$tmp" "$target"`,
+		"trap - EXIT",
+	)
+
+	_, _, err := ex.RunWithStdin(ctx, strings.Join(lines, "\n"), content)
+
+	if exitStatus, _ := ExitStatus(err); exitStatus == validationFailed {
+		return attributeError("validate_command", errors.Wrapf(err, "validate_command rejected the new content of %s", name))
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "while writing %s", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package sshsession
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+)
+
+func TestWriteFile(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, ConnectionSchema(map[string]*schema.Schema{}), map[string]interface{}{
+		"connection_type": "local",
+	})
+
+	ex, err := ExecutorFor(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+
+	o := WriteFileOptions{
+		Owner:           strconv.Itoa(os.Getuid()),
+		Group:           strconv.Itoa(os.Getgid()),
+		Mode:            "640",
+		ValidateCommand: "grep -q valid %s",
+	}
+
+	err = WriteFile(context.Background(), ex, path, strings.NewReader("valid\n"), o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = WriteFile(context.Background(), ex, path, strings.NewReader("broken\n"), o)
+
+	var ae *AttributeError
+	if !errors.As(err, &ae) || ae.Attribute != "validate_command" {
+		t.Fatalf("expected validate_command to reject the content, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "valid\n" {
+		t.Errorf("expected the rejected content not to be written, got %q", data)
+	}
+
+	st, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if st.Mode().Perm() != 0640 {
+		t.Errorf("expected mode 640, got %o", st.Mode().Perm())
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("expected the temporary file to be removed, got %d files", len(entries))
+	}
+}
+
+func TestWriteFileSymlink(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, ConnectionSchema(map[string]*schema.Schema{}), map[string]interface{}{
+		"connection_type": "local",
+	})
+
+	ex, err := ExecutorFor(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	link := filepath.Join(dir, "link")
+
+	err = os.Symlink(target, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = WriteFile(context.Background(), ex, link, strings.NewReader("hello\n"), WriteFileOptions{Mode: "644"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if st.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected %s to stay a symlink", link)
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "hello\n" {
+		t.Errorf("expected the content to be written to the target of the symlink, got %q", data)
+	}
+}